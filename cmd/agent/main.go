@@ -1,23 +1,105 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/AzizovHikmatullo/calc-go_V2/internal/agent"
 	"github.com/AzizovHikmatullo/calc-go_V2/pkg"
-	"github.com/joho/godotenv"
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/logging"
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/trace"
 )
 
-// Gets constants from env and start agent
+// Gets constants from env and start agent. Worker limits, PING_MS and LOG_LEVEL are applied live when .env changes or on SIGHUP,
+// SIGINT and SIGTERM stop agent after current tasks are finished or handed back
 func main() {
-	if err := godotenv.Load(); err != nil {
-		log.Fatal("Error loading .env file")
+	if err := pkg.LoadEnvFile(".env"); err != nil {
+		fatal("Error loading .env file", err)
 	}
 
-	cntGoroutines := pkg.GetEnvIntWithDefault("COMPUTING_POWER", 5)
-	pingTime := pkg.GetEnvIntWithDefault("PING_MS", 1000)
+	if err := logging.Setup(os.Stderr, pkg.GetEnvWithDefault("LOG_FORMAT", "json"), pkg.GetEnvWithDefault("LOG_LEVEL", "info")); err != nil {
+		fatal("Error configuring logger", err)
+	}
+
+	client, err := agent.NewHTTPClient(
+		pkg.GetEnvWithDefault("AGENT_TLS_CERT", ""),
+		pkg.GetEnvWithDefault("AGENT_TLS_KEY", ""),
+		pkg.GetEnvWithDefault("ORCHESTRATOR_CA", ""),
+	)
+	if err != nil {
+		fatal("Error creating HTTP client", err)
+	}
+
+	exporter, err := trace.NewExporter(pkg.GetEnvWithDefault("TRACE_EXPORTER", ""), pkg.GetEnvWithDefault("TRACE_FILE", ""))
+	if err != nil {
+		fatal("Error creating trace exporter", err)
+	}
+
+	newAgent := agent.NewAgent(agent.Config{
+		ID:                pkg.GetEnvWithDefault("AGENT_ID", ""),
+		Workers:           pkg.GetEnvIntWithDefault("COMPUTING_POWER", 5),
+		MinWorkers:        minWorkers(),
+		MaxWorkers:        maxWorkers(),
+		ScaleInterval:     time.Duration(pkg.GetEnvIntWithDefault("AGENT_SCALE_INTERVAL_MS", 2000)) * time.Millisecond,
+		HeartbeatInterval: time.Duration(pkg.GetEnvIntWithDefault("AGENT_HEARTBEAT_MS", 5000)) * time.Millisecond,
+		PingTime:          pkg.GetEnvIntWithDefault("PING_MS", 1000),
+		OrchestratorURL:   pkg.GetEnvWithDefault("ORCHESTRATOR_URL", "http://localhost:8080"),
+		Token:             pkg.GetEnvWithDefault("AGENT_TOKEN", ""),
+		Client:            client,
+		ShutdownTimeout:   time.Duration(pkg.GetEnvIntWithDefault("SHUTDOWN_TIMEOUT_MS", 30000)) * time.Millisecond,
+		TraceExporter:     exporter,
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go pkg.WatchEnvFile(ctx, ".env", 2*time.Second, func() {
+		if err := logging.SetLevel(pkg.GetEnvWithDefault("LOG_LEVEL", "info")); err != nil {
+			slog.Error("Error changing log level", "error", err)
+		}
+		newAgent.SetWorkerLimits(minWorkers(), maxWorkers())
+		newAgent.SetPingTime(pkg.GetEnvIntWithDefault("PING_MS", 1000))
+	})
+
+	if addr := agentHTTPAddr(); addr != "" {
+		server := &http.Server{Addr: addr, Handler: newAgent.Handler()}
+		go func() {
+			slog.Info("Starting agent HTTP server", "addr", addr)
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("Agent HTTP server error", "error", err)
+			}
+		}()
+		defer server.Close()
+	}
+
+	newAgent.Run(ctx)
+}
 
-	newAgent := agent.NewAgent(cntGoroutines, pingTime)
+// agentHTTPAddr - address of /metrics and /healthz. Unset variable means :8090, empty value turns server off
+func agentHTTPAddr() string {
+	if addr, ok := os.LookupEnv("AGENT_HTTP_ADDR"); ok {
+		return addr
+	}
+	return ":8090"
+}
+
+// minWorkers - lower bound of worker pool. Without AGENT_MIN_WORKERS and AGENT_MAX_WORKERS pool has COMPUTING_POWER workers
+func minWorkers() int {
+	return pkg.GetEnvIntWithDefault("AGENT_MIN_WORKERS", pkg.GetEnvIntWithDefault("COMPUTING_POWER", 5))
+}
+
+// maxWorkers - upper bound of worker pool
+func maxWorkers() int {
+	return pkg.GetEnvIntWithDefault("AGENT_MAX_WORKERS", pkg.GetEnvIntWithDefault("COMPUTING_POWER", 5))
+}
 
-	newAgent.Run()
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
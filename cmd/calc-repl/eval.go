@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/calc"
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/client"
+)
+
+// evaluator - calculates expressions without variables and builds their AST
+type evaluator interface {
+	name() string
+	evaluate(ctx context.Context, expression string) (float64, error)
+	parse(ctx context.Context, expression string) (*calc.Node, error)
+}
+
+// localEvaluator - calculates in process through pkg/calc
+type localEvaluator struct{}
+
+func (localEvaluator) name() string { return "local" }
+
+func (localEvaluator) evaluate(ctx context.Context, expression string) (float64, error) {
+	root, err := calc.Parse(expression)
+	if err != nil {
+		return 0, err
+	}
+	return root.Evaluate()
+}
+
+func (localEvaluator) parse(ctx context.Context, expression string) (*calc.Node, error) {
+	return calc.Parse(expression)
+}
+
+// remoteEvaluator - sends expressions to orchestrator and waits for result
+type remoteEvaluator struct {
+	client *client.Client
+}
+
+func (remoteEvaluator) name() string { return "remote" }
+
+// evaluate - calculates expression on agents. Expression is cancelled on server if ctx is done before result
+func (e remoteEvaluator) evaluate(ctx context.Context, expression string) (float64, error) {
+	id, err := e.client.Submit(ctx, expression, client.SubmitOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	expr, err := e.client.Wait(ctx, id)
+	if err != nil {
+		if ctx.Err() != nil {
+			e.client.Cancel(context.Background(), id)
+		}
+		return 0, err
+	}
+	if err := expr.Err(); err != nil {
+		return 0, err
+	}
+	return expr.Result, nil
+}
+
+// parse - AST built by orchestrator, without optimizations
+func (e remoteEvaluator) parse(ctx context.Context, expression string) (*calc.Node, error) {
+	explain, err := e.client.Explain(ctx, expression, false)
+	if err != nil {
+		return nil, err
+	}
+	if explain.Tree == nil {
+		return nil, errors.New("empty expression")
+	}
+	return explain.Tree.Node(), nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg"
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/client"
+)
+
+// maxHistory - how many lines of history file are loaded on start
+const maxHistory = 1000
+
+// Reads expressions line by line and calculates them locally or on orchestrator.
+// Ctrl+C cancels current calculation or exits at the prompt, Ctrl+D or :quit exits
+func main() {
+	remote := flag.Bool("remote", false, "calculate on orchestrator instead of locally")
+	baseURL := flag.String("url", pkg.GetEnvWithDefault("CALCCTL_URL", "http://localhost:8080"), "orchestrator URL")
+	token := flag.String("token", os.Getenv("CALCCTL_TOKEN"), "access token")
+	apiKey := flag.String("api-key", os.Getenv("CALCCTL_API_KEY"), "API key, used instead of token")
+	historyPath := flag.String("history", defaultHistoryPath(), "history file, empty to disable")
+	flag.Parse()
+
+	r := &repl{
+		local: localEvaluator{},
+		vars:  make(map[string]float64),
+		out:   os.Stdout,
+	}
+	r.current = r.local
+
+	if *baseURL != "" {
+		c := client.New(*baseURL)
+		c.Token = *token
+		c.APIKey = *apiKey
+		r.remote = remoteEvaluator{client: c}
+	}
+	if *remote {
+		if r.remote == nil {
+			fmt.Fprintln(os.Stderr, "Orchestrator URL is not set")
+			os.Exit(2)
+		}
+		r.current = r.remote
+	}
+
+	closer, err := r.loadHistory(*historyPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error opening history file:", err)
+	}
+	if closer != nil {
+		defer closer.Close()
+	}
+
+	interactive := isTerminal(os.Stdin)
+	if interactive {
+		fmt.Printf("calc-repl (%v mode), :help for commands\n", r.current.name())
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		if interactive {
+			fmt.Print("> ")
+		}
+		if !scanner.Scan() {
+			break
+		}
+
+		// interrupts are caught only while line is handled, at the prompt Ctrl+C exits as usual
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		ok := r.handle(ctx, scanner.Text())
+		stop()
+		if !ok {
+			return
+		}
+	}
+	if interactive {
+		fmt.Println()
+	}
+}
+
+// defaultHistoryPath - CALC_REPL_HISTORY or ~/.calc_history
+func defaultHistoryPath() string {
+	if path, ok := os.LookupEnv("CALC_REPL_HISTORY"); ok {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".calc_history")
+}
+
+// isTerminal - checks if f is terminal, prompt is not printed for piped input
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// lastResult - variable with result of previous expression
+const lastResult = "_"
+
+const helpText = `Expressions:
+  2+2*2          calculate expression
+  x = 3*4        calculate expression and save result to variable x
+  x*2 + _        use variables, _ is result of previous expression
+  !n             repeat line n from :history
+
+Commands:
+  :help          show this help
+  :vars          show variables
+  :explain expr  show AST of expression without calculating it
+  :ast           toggle AST output after every expression
+  :mode [m]      show or change mode: local or remote
+  :history       show history
+  :clear         remove all variables
+  :quit          exit (also Ctrl+D)
+`
+
+// repl - state of interactive session
+type repl struct {
+	local   evaluator
+	remote  evaluator
+	current evaluator
+
+	vars    map[string]float64
+	history []string
+	showAST bool
+
+	historyFile io.Writer
+	out         io.Writer
+}
+
+// handle - executes one input line. Returns false when session should end
+func (r *repl) handle(ctx context.Context, line string) bool {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return true
+	}
+
+	if strings.HasPrefix(line, "!") {
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 1 || n > len(r.history) {
+			fmt.Fprintln(r.out, "Error: no such history entry")
+			return true
+		}
+		line = r.history[n-1]
+		fmt.Fprintln(r.out, line)
+	}
+	r.remember(line)
+
+	if strings.HasPrefix(line, ":") {
+		return r.command(ctx, line)
+	}
+
+	if err := r.calculate(ctx, line); err != nil {
+		fmt.Fprintln(r.out, "Error:", err)
+	}
+	return true
+}
+
+// remember - adds line to history and history file
+func (r *repl) remember(line string) {
+	if len(r.history) > 0 && r.history[len(r.history)-1] == line {
+		return
+	}
+	r.history = append(r.history, line)
+	if r.historyFile != nil {
+		fmt.Fprintln(r.historyFile, line)
+	}
+}
+
+// command - executes line which starts with ':'
+func (r *repl) command(ctx context.Context, line string) bool {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case ":help", ":h":
+		fmt.Fprint(r.out, helpText)
+	case ":quit", ":q", ":exit":
+		return false
+	case ":vars":
+		r.printVars()
+	case ":clear":
+		r.vars = make(map[string]float64)
+	case ":history":
+		for i, entry := range r.history {
+			fmt.Fprintf(r.out, "%4d  %s\n", i+1, entry)
+		}
+	case ":ast":
+		r.showAST = !r.showAST
+		fmt.Fprintf(r.out, "AST output: %v\n", onOff(r.showAST))
+	case ":mode":
+		r.setMode(arg)
+	case ":explain":
+		if err := r.explain(ctx, arg); err != nil {
+			fmt.Fprintln(r.out, "Error:", err)
+		}
+	default:
+		fmt.Fprintf(r.out, "Unknown command %v, see :help\n", name)
+	}
+	return true
+}
+
+func (r *repl) setMode(mode string) {
+	switch mode {
+	case "":
+	case "local":
+		r.current = r.local
+	case "remote":
+		if r.remote == nil {
+			fmt.Fprintln(r.out, "Error: orchestrator URL is not set")
+			return
+		}
+		r.current = r.remote
+	default:
+		fmt.Fprintf(r.out, "Error: unknown mode %q\n", mode)
+		return
+	}
+	fmt.Fprintf(r.out, "Mode: %v\n", r.current.name())
+}
+
+func (r *repl) printVars() {
+	names := make([]string, 0, len(r.vars))
+	for name := range r.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(r.out, "%v = %v\n", name, formatFloat(r.vars[name]))
+	}
+}
+
+// calculate - evaluates expression or assignment "name = expression" and prints result
+func (r *repl) calculate(ctx context.Context, line string) error {
+	target, expression, err := splitAssignment(line)
+	if err != nil {
+		return err
+	}
+
+	expression, err = r.substitute(expression)
+	if err != nil {
+		return err
+	}
+
+	if r.showAST {
+		if err := r.printAST(ctx, expression); err != nil {
+			return err
+		}
+	}
+
+	result, err := r.current.evaluate(ctx, expression)
+	if err != nil {
+		return err
+	}
+
+	r.vars[lastResult] = result
+	if target != "" {
+		r.vars[target] = result
+		fmt.Fprintf(r.out, "%v = %v\n", target, formatFloat(result))
+		return nil
+	}
+	fmt.Fprintln(r.out, formatFloat(result))
+	return nil
+}
+
+// explain - prints AST of expression with variables replaced by values
+func (r *repl) explain(ctx context.Context, expression string) error {
+	if expression == "" {
+		return errors.New("usage: :explain <expression>")
+	}
+	expression, err := r.substitute(expression)
+	if err != nil {
+		return err
+	}
+	return r.printAST(ctx, expression)
+}
+
+func (r *repl) printAST(ctx context.Context, expression string) error {
+	root, err := r.current.parse(ctx, expression)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(r.out, root.Tree())
+	return nil
+}
+
+// splitAssignment - splits "name = expression" into name and expression. Without '=' name is empty
+func splitAssignment(line string) (string, string, error) {
+	name, expression, ok := strings.Cut(line, "=")
+	if !ok {
+		return "", line, nil
+	}
+
+	name = strings.TrimSpace(name)
+	if !isIdentifier(name) {
+		return "", "", fmt.Errorf("invalid variable name %q", name)
+	}
+	if name == lastResult {
+		return "", "", fmt.Errorf("%v is read-only", lastResult)
+	}
+	if strings.TrimSpace(expression) == "" {
+		return "", "", errors.New("missing expression after '='")
+	}
+	return name, expression, nil
+}
+
+// substitute - replaces variables in expression with their values. Negative values are wrapped as (0-x),
+// because expressions have no unary minus. Infinity and NaN can't be written as number, so they are errors
+func (r *repl) substitute(expression string) (string, error) {
+	var b strings.Builder
+	runes := []rune(expression)
+
+	for i := 0; i < len(runes); {
+		if !isIdentStart(runes[i]) {
+			b.WriteRune(runes[i])
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(runes) && (isIdentStart(runes[i]) || unicode.IsDigit(runes[i])) {
+			i++
+		}
+		name := string(runes[start:i])
+
+		value, ok := r.vars[name]
+		if !ok {
+			return "", fmt.Errorf("unknown variable %v", name)
+		}
+		if math.IsInf(value, 0) || math.IsNaN(value) {
+			return "", fmt.Errorf("variable %v is %v and can't be used in expression", name, formatFloat(value))
+		}
+		if value < 0 {
+			b.WriteString("(0-" + strconv.FormatFloat(-value, 'f', -1, 64) + ")")
+		} else {
+			b.WriteString("(" + strconv.FormatFloat(value, 'f', -1, 64) + ")")
+		}
+	}
+	return b.String(), nil
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentifier(s string) bool {
+	for i, r := range s {
+		if !isIdentStart(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// loadHistory - reads previous lines from history file and opens it for appending
+func (r *repl) loadHistory(path string) (io.Closer, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				r.history = append(r.history, line)
+			}
+		}
+		f.Close()
+		if len(r.history) > maxHistory {
+			r.history = r.history[len(r.history)-maxHistory:]
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	r.historyFile = f
+	return f, nil
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func onOff(v bool) string {
+	if v {
+		return "on"
+	}
+	return "off"
+}
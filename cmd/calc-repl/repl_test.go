@@ -0,0 +1,99 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSplitAssignment(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		target     string
+		expression string
+		err        bool
+	}{
+		{name: "Expression", input: "2+2", expression: "2+2"},
+		{name: "Assignment", input: "x = 3*4", target: "x", expression: " 3*4"},
+		{name: "Name with digits", input: "x1=2", target: "x1", expression: "2"},
+		{name: "Invalid name", input: "1x = 2", err: true},
+		{name: "Empty name", input: "= 2", err: true},
+		{name: "Last result is read-only", input: "_ = 2", err: true},
+		{name: "Missing expression", input: "x = ", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, expression, err := splitAssignment(tt.input)
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if target != tt.target || expression != tt.expression {
+				t.Errorf("expected %q and %q, got %q and %q", tt.target, tt.expression, target, expression)
+			}
+		})
+	}
+}
+
+func TestSubstitute(t *testing.T) {
+	r := &repl{vars: map[string]float64{
+		"x":   3,
+		"neg": -2.5,
+		"_":   10,
+		"y1":  0.1,
+		"big": 1e21,
+		"inf": math.Inf(1),
+		"nan": math.NaN(),
+	}}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		err      bool
+	}{
+		{name: "Without variables", input: "1+2", expected: "1+2"},
+		{name: "Variable", input: "x*2", expected: "(3)*2"},
+		{name: "Negative value", input: "neg+1", expected: "(0-2.5)+1"},
+		{name: "Last result", input: "_+x", expected: "(10)+(3)"},
+		{name: "Name with digits", input: "y1*10", expected: "(0.1)*10"},
+		{name: "Large value without exponent", input: "big", expected: "(1000000000000000000000)"},
+		{name: "Unknown variable", input: "z+1", err: true},
+		{name: "Infinity", input: "inf+1", err: true},
+		{name: "NaN", input: "nan", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := r.substitute(tt.input)
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestIsIdentifier(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"x", true},
+		{"_", true},
+		{"total_2", true},
+		{"число", true},
+		{"", false},
+		{"2x", false},
+		{"x-y", false},
+		{"x y", false},
+	}
+
+	for _, tt := range tests {
+		if got := isIdentifier(tt.input); got != tt.expected {
+			t.Errorf("isIdentifier(%q): expected %v, got %v", tt.input, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/logging"
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/sim"
+)
+
+// Plays simulation script from file or stdin and prints timeline. Logs of orchestrator are hidden unless -log is set
+func main() {
+	logLevel := flag.String("log", "", "show orchestrator logs with level: debug, info, warn or error")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: calc-sim [-log level] [script]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *logLevel != "" {
+		if err := logging.Setup(os.Stderr, "text", *logLevel); err != nil {
+			fatal(err)
+		}
+	} else {
+		slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	}
+
+	var input io.Reader = os.Stdin
+	if flag.NArg() > 0 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			fatal(err)
+		}
+		defer f.Close()
+		input = f
+	}
+
+	script, err := sim.Parse(input)
+	if err != nil {
+		fatal(err)
+	}
+
+	report, err := sim.Run(script)
+	if err != nil {
+		fatal(err)
+	}
+
+	if err := report.Print(os.Stdout); err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "Error:", err)
+	os.Exit(1)
+}
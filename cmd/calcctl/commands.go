@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/client"
+)
+
+// newFlags - flag set of subcommand, errors are returned instead of exiting
+func newFlags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// parse - parses flags and checks amount of positional arguments
+func parse(fs *flag.FlagSet, args []string, nargs int) error {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return err
+		}
+		return usageError{err.Error()}
+	}
+	if fs.NArg() != nargs {
+		return usageError{fmt.Sprintf("expected %d argument(s), got %d", nargs, fs.NArg())}
+	}
+	return nil
+}
+
+// checkResult - errFailed if any expression did not complete successfully
+func checkResult(exprs ...client.Expression) error {
+	for _, expr := range exprs {
+		if expr.Err() != nil {
+			return errFailed
+		}
+	}
+	return nil
+}
+
+func runSubmit(ctx context.Context, e *env, args []string) error {
+	fs := newFlags("submit")
+	wait := fs.Bool("wait", false, "wait for result")
+	noCache := fs.Bool("no-cache", false, "don't use cached results of tasks")
+	optimize := fs.Bool("optimize", false, "optimize expression before calculation")
+	priority := fs.String("priority", "", "priority: high, normal or low")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	id, err := e.client.Submit(ctx, fs.Arg(0), client.SubmitOptions{NoCache: *noCache, Optimize: *optimize, Priority: *priority})
+	if err != nil {
+		return err
+	}
+
+	if !*wait {
+		return printExpressions(e.stdout, e.format, []client.Expression{{ID: id, Expression: fs.Arg(0), Status: client.StatusQueued}})
+	}
+
+	expr, err := e.client.Wait(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := printExpressions(e.stdout, e.format, []client.Expression{*expr}); err != nil {
+		return err
+	}
+	return checkResult(*expr)
+}
+
+func runGet(ctx context.Context, e *env, args []string) error {
+	fs := newFlags("get")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	expr, err := e.client.Get(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := printExpressions(e.stdout, e.format, []client.Expression{*expr}); err != nil {
+		return err
+	}
+	return checkResult(*expr)
+}
+
+func runList(ctx context.Context, e *env, args []string) error {
+	fs := newFlags("list")
+	status := fs.String("status", "", "show only expressions with status")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	exprs, err := e.client.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	if *status != "" {
+		filtered := exprs[:0]
+		for _, expr := range exprs {
+			if expr.Status == *status {
+				filtered = append(filtered, expr)
+			}
+		}
+		exprs = filtered
+	}
+	return printExpressions(e.stdout, e.format, exprs)
+}
+
+func runWatch(ctx context.Context, e *env, args []string) error {
+	fs := newFlags("watch")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	w := newWatchPrinter(e.stdout, e.format)
+	var last *client.Expression
+	for update := range e.client.Stream(ctx, fs.Arg(0)) {
+		if update.Err != nil {
+			return update.Err
+		}
+		last = update.Expression
+		if err := w.print(time.Now(), *last); err != nil {
+			return err
+		}
+	}
+
+	if last == nil || !last.Finished() {
+		return ctx.Err()
+	}
+	return checkResult(*last)
+}
+
+func runCancel(ctx context.Context, e *env, args []string) error {
+	fs := newFlags("cancel")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	expr, err := e.client.Cancel(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return printExpressions(e.stdout, e.format, []client.Expression{*expr})
+}
+
+func runExplain(ctx context.Context, e *env, args []string) error {
+	fs := newFlags("explain")
+	optimize := fs.Bool("optimize", false, "show tree after optimization")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	explain, err := e.client.Explain(ctx, fs.Arg(0), *optimize)
+	if err != nil {
+		return err
+	}
+	return printExplain(e.stdout, e.format, explain)
+}
+
+// runBatch - submits every non-empty line which is not a # comment. With -wait prints results and
+// fails if any expression failed
+func runBatch(ctx context.Context, e *env, args []string) error {
+	fs := newFlags("batch")
+	file := fs.String("file", "-", "file with one expression per line, - for stdin")
+	wait := fs.Bool("wait", false, "wait for all results")
+	optimize := fs.Bool("optimize", false, "optimize expressions before calculation")
+	priority := fs.String("priority", "", "priority: high, normal or low")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	in := e.stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return usageError{err.Error()}
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var exprs []client.Expression
+	failed := false
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		id, err := e.client.Submit(ctx, line, client.SubmitOptions{Optimize: *optimize, Priority: *priority})
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// rejected expression doesn't stop the rest of batch, but unreachable or refusing server does
+			if !errors.Is(err, client.ErrInvalidRequest) {
+				return fmt.Errorf("submitting %q: %w", line, err)
+			}
+			fmt.Fprintf(e.stderr, "Error submitting %q: %v\n", line, err)
+			failed = true
+			continue
+		}
+		exprs = append(exprs, client.Expression{ID: id, Expression: line, Status: client.StatusQueued})
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if *wait {
+		ids := make([]string, len(exprs))
+		index := make(map[string]int, len(exprs))
+		for i, expr := range exprs {
+			ids[i] = expr.ID
+			index[expr.ID] = i
+		}
+
+		for update := range e.client.Stream(ctx, ids...) {
+			if update.Err != nil {
+				return update.Err
+			}
+			exprs[index[update.ID]] = *update.Expression
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+
+	if err := printExpressions(e.stdout, e.format, exprs); err != nil {
+		return err
+	}
+	if failed {
+		return errFailed
+	}
+	return checkResult(exprs...)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/client"
+)
+
+// Exit codes of calcctl
+const (
+	exitOK         = 0
+	exitFailed     = 1 // expression finished with error or was cancelled
+	exitUsage      = 2 // wrong arguments or config
+	exitRequest    = 3 // orchestrator is unreachable or rejected request
+	defaultBaseURL = "http://localhost:8080"
+)
+
+// Config - settings from config file, overridden by env and flags
+type Config struct {
+	URL    string `json:"url"`
+	Token  string `json:"token"`
+	APIKey string `json:"api_key"`
+	Output string `json:"output"`
+}
+
+// usageError - wrong arguments of command
+type usageError struct{ msg string }
+
+func (e usageError) Error() string { return e.msg }
+
+// errFailed - expression did not complete successfully
+var errFailed = errors.New("expression failed")
+
+// command - subcommand of calcctl
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(ctx context.Context, env *env, args []string) error
+}
+
+var commands = []command{
+	{"submit", "submit [-wait] [-no-cache] [-optimize] [-priority p] <expression>", "send expression for calculation", runSubmit},
+	{"get", "get <id>", "show expression", runGet},
+	{"list", "list [-status s]", "show all expressions", runList},
+	{"watch", "watch <id>", "print status changes until expression is finished", runWatch},
+	{"cancel", "cancel <id>", "cancel expression", runCancel},
+	{"explain", "explain [-optimize] <expression>", "show AST without calculating", runExplain},
+	{"batch", "batch [-file path] [-wait] [-optimize] [-priority p]", "submit expressions line by line from file or stdin", runBatch},
+}
+
+// env - everything commands need: API client, output format and streams
+type env struct {
+	client *client.Client
+	format string
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run - parses global flags, loads config and runs subcommand. Returns exit code
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	global := flag.NewFlagSet("calcctl", flag.ContinueOnError)
+	global.SetOutput(stderr)
+	configPath := global.String("config", defaultConfigPath(), "path to config file")
+	baseURL := global.String("url", "", "orchestrator URL")
+	token := global.String("token", "", "access token")
+	apiKey := global.String("api-key", "", "API key, used instead of token")
+	output := global.String("o", "", "output format: table, json or csv")
+	global.Usage = func() { printUsage(stderr, global) }
+
+	if err := global.Parse(args); err != nil {
+		return exitUsage
+	}
+	if global.NArg() == 0 {
+		printUsage(stderr, global)
+		return exitUsage
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintln(stderr, "Error loading config:", err)
+		return exitUsage
+	}
+	applyEnv(&cfg)
+	override(&cfg.URL, *baseURL)
+	override(&cfg.Token, *token)
+	override(&cfg.APIKey, *apiKey)
+	override(&cfg.Output, *output)
+
+	if cfg.URL == "" {
+		cfg.URL = defaultBaseURL
+	}
+	if cfg.Output == "" {
+		cfg.Output = "table"
+	}
+	if cfg.Output != "table" && cfg.Output != "json" && cfg.Output != "csv" {
+		fmt.Fprintf(stderr, "Unknown output format %q\n", cfg.Output)
+		return exitUsage
+	}
+
+	name := global.Arg(0)
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == name {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(stderr, "Unknown command %q\n", name)
+		printUsage(stderr, global)
+		return exitUsage
+	}
+
+	c := client.New(cfg.URL)
+	c.Token = cfg.Token
+	c.APIKey = cfg.APIKey
+
+	err = cmd.run(ctx, &env{client: c, format: cfg.Output, stdin: stdin, stdout: stdout, stderr: stderr}, global.Args()[1:])
+
+	var usageErr usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.As(err, &usageErr):
+		fmt.Fprintln(stderr, "Usage: calcctl", cmd.usage)
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	case errors.Is(err, errFailed):
+		return exitFailed
+	default:
+		fmt.Fprintln(stderr, "Error:", err)
+		return exitRequest
+	}
+}
+
+func printUsage(w io.Writer, global *flag.FlagSet) {
+	fmt.Fprintln(w, "Usage: calcctl [flags] <command> [command flags] [args]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-9s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w, "\nFlags:")
+	global.PrintDefaults()
+}
+
+// defaultConfigPath - CALCCTL_CONFIG or ~/.config/calcctl/config.json
+func defaultConfigPath() string {
+	if path := os.Getenv("CALCCTL_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "calcctl", "config.json")
+}
+
+// loadConfig - reads config file. Missing file means empty config
+func loadConfig(path string) (Config, error) {
+	var cfg Config
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("%v: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// applyEnv - overrides config with CALCCTL_URL, CALCCTL_TOKEN and CALCCTL_API_KEY
+func applyEnv(cfg *Config) {
+	override(&cfg.URL, os.Getenv("CALCCTL_URL"))
+	override(&cfg.Token, os.Getenv("CALCCTL_TOKEN"))
+	override(&cfg.APIKey, os.Getenv("CALCCTL_API_KEY"))
+}
+
+func override(dst *string, value string) {
+	if value != "" {
+		*dst = value
+	}
+}
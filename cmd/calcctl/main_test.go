@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeServer - orchestrator with two finished expressions. Requests without token get 401,
+// expressions with priority "bogus" are rejected
+func fakeServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	value := 2.0
+	expressions := map[string]map[string]interface{}{
+		"ok":     {"id": "ok", "expression": "2+2", "status": "completed", "result": 4},
+		"failed": {"id": "failed", "expression": "1/0", "status": "error", "result": 0},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/expressions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		expr, ok := expressions[r.PathValue("id")]
+		if !ok {
+			http.Error(w, "Expression not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"expression": expr})
+	})
+	mux.HandleFunc("POST /api/v1/calculate", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req["priority"] == "bogus" {
+			http.Error(w, "Invalid priority", http.StatusUnprocessableEntity)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"id": "new"})
+	})
+	mux.HandleFunc("POST /api/v1/explain", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"explain": map[string]interface{}{
+			"expression": "2*2",
+			"postfix":    []string{"2", "2", "*"},
+			"tree":       map[string]interface{}{"operation": "*", "left": map[string]interface{}{"value": value}, "right": map[string]interface{}{"value": value}},
+			"operations": 1,
+			"depth":      1,
+		}})
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func runCalcctl(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	for _, key := range []string{"CALCCTL_URL", "CALCCTL_TOKEN", "CALCCTL_API_KEY"} {
+		t.Setenv(key, "")
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), append([]string{"-config", ""}, args...), strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestExitCodes(t *testing.T) {
+	server := fakeServer(t)
+
+	tests := []struct {
+		name     string
+		stdin    string
+		args     []string
+		expected int
+	}{
+		{name: "Completed", args: []string{"-token", "secret", "-url", server.URL, "get", "ok"}, expected: exitOK},
+		{name: "Failed expression", args: []string{"-token", "secret", "-url", server.URL, "get", "failed"}, expected: exitFailed},
+		{name: "Unknown command", args: []string{"frobnicate"}, expected: exitUsage},
+		{name: "Missing argument", args: []string{"-url", server.URL, "get"}, expected: exitUsage},
+		{name: "Unknown format", args: []string{"-o", "xml", "get", "ok"}, expected: exitUsage},
+		{name: "Not found", args: []string{"-token", "secret", "-url", server.URL, "get", "missing"}, expected: exitRequest},
+		{name: "Unauthorized", args: []string{"-url", server.URL, "get", "ok"}, expected: exitRequest},
+		{name: "Unreachable", args: []string{"-url", "http://127.0.0.1:1", "get", "ok"}, expected: exitRequest},
+		{name: "Batch", stdin: "2+2\n# comment\n\n3*3\n", args: []string{"-token", "secret", "-url", server.URL, "batch"}, expected: exitOK},
+		{name: "Batch with rejected expression", stdin: "2+2\n", args: []string{"-token", "secret", "-url", server.URL, "batch", "-priority", "bogus"}, expected: exitFailed},
+		{name: "Batch unauthorized", stdin: "2+2\n", args: []string{"-url", server.URL, "batch"}, expected: exitRequest},
+		{name: "Batch unreachable", stdin: "2+2\n", args: []string{"-url", "http://127.0.0.1:1", "batch"}, expected: exitRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, stderr := runCalcctl(t, tt.stdin, tt.args...)
+			if code != tt.expected {
+				t.Errorf("expected exit code %v, got %v (%v)", tt.expected, code, stderr)
+			}
+		})
+	}
+}
+
+func TestOutputFormats(t *testing.T) {
+	server := fakeServer(t)
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{format: "table", expected: "ID  STATUS     RESULT  EXPRESSION\nok  completed  4       2+2\n"},
+		{format: "csv", expected: "id,status,result,expression\nok,completed,4,2+2\n"},
+		{format: "json", expected: "[\n  {\n    \"id\": \"ok\",\n    \"expression\": \"2+2\",\n    \"status\": \"completed\",\n    \"result\": 4\n  }\n]\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			code, stdout, stderr := runCalcctl(t, "", "-token", "secret", "-url", server.URL, "-o", tt.format, "get", "ok")
+			if code != exitOK {
+				t.Fatalf("expected exit code 0, got %v (%v)", code, stderr)
+			}
+			if stdout != tt.expected {
+				t.Errorf("expected output:\n%v\ngot:\n%v", tt.expected, stdout)
+			}
+		})
+	}
+
+	code, stdout, stderr := runCalcctl(t, "", "-token", "secret", "-url", server.URL, "explain", "2*2")
+	if code != exitOK {
+		t.Fatalf("expected exit code 0, got %v (%v)", code, stderr)
+	}
+	if !strings.HasSuffix(stdout, "\n*\n├── 2\n└── 2\n") {
+		t.Errorf("expected AST in output, got:\n%v", stdout)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/client"
+)
+
+var expressionHeader = []string{"ID", "STATUS", "RESULT", "EXPRESSION"}
+
+// expressionRow - fields of expression in order of expressionHeader. Result is empty until expression is completed
+func expressionRow(expr client.Expression) []string {
+	result := ""
+	if expr.Status == client.StatusCompleted {
+		result = formatFloat(expr.Result)
+	}
+	return []string{expr.ID, expr.Status, result, expr.Expression}
+}
+
+// printExpressions - writes expressions as table, JSON array or CSV with header
+func printExpressions(w io.Writer, format string, exprs []client.Expression) error {
+	switch format {
+	case "json":
+		if exprs == nil {
+			exprs = []client.Expression{}
+		}
+		return writeJSON(w, exprs)
+	case "csv":
+		rows := [][]string{lower(expressionHeader)}
+		for _, expr := range exprs {
+			rows = append(rows, expressionRow(expr))
+		}
+		return writeCSV(w, rows)
+	default:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(expressionHeader, "\t"))
+		for _, expr := range exprs {
+			fmt.Fprintln(tw, strings.Join(expressionRow(expr), "\t"))
+		}
+		return tw.Flush()
+	}
+}
+
+// watchPrinter - writes one line per status change: table row, JSON object or CSV record
+type watchPrinter struct {
+	w      io.Writer
+	format string
+	header bool
+}
+
+func newWatchPrinter(w io.Writer, format string) *watchPrinter {
+	return &watchPrinter{w: w, format: format}
+}
+
+func (p *watchPrinter) print(at time.Time, expr client.Expression) error {
+	switch p.format {
+	case "json":
+		return json.NewEncoder(p.w).Encode(map[string]interface{}{"time": at, "expression": expr})
+	case "csv":
+		row := append([]string{at.Format(time.RFC3339)}, expressionRow(expr)...)
+		if !p.header {
+			p.header = true
+			return writeCSV(p.w, [][]string{append([]string{"time"}, lower(expressionHeader)...), row})
+		}
+		return writeCSV(p.w, [][]string{row})
+	default:
+		row := expressionRow(expr)
+		_, err := fmt.Fprintf(p.w, "%s  %-10s  %s\n", at.Format("15:04:05"), row[1], row[2])
+		return err
+	}
+}
+
+// printExplain - writes AST as indented tree, JSON object or CSV summary
+func printExplain(w io.Writer, format string, explain *client.Explain) error {
+	switch format {
+	case "json":
+		return writeJSON(w, explain)
+	case "csv":
+		return writeCSV(w, [][]string{
+			{"expression", "postfix", "operations", "depth"},
+			{explain.Expression, strings.Join(explain.Postfix, " "), strconv.Itoa(explain.Operations), strconv.Itoa(explain.Depth)},
+		})
+	default:
+		fmt.Fprintf(w, "Expression: %s\n", explain.Expression)
+		fmt.Fprintf(w, "Postfix:    %s\n", strings.Join(explain.Postfix, " "))
+		fmt.Fprintf(w, "Operations: %d, depth: %d\n", explain.Operations, explain.Depth)
+		for _, opt := range explain.Optimizations {
+			fmt.Fprintf(w, "Optimized:  %s -> %s (%s)\n", opt.Before, opt.After, opt.Rule)
+		}
+		if explain.Tree != nil {
+			fmt.Fprintln(w)
+			fmt.Fprint(w, explain.Tree.Node().Tree())
+		}
+		return nil
+	}
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeCSV(w io.Writer, rows [][]string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func lower(values []string) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = strings.ToLower(v)
+	}
+	return out
+}
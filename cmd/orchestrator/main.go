@@ -1,19 +1,53 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/AzizovHikmatullo/calc-go_V2/internal/orchestrator"
-	"github.com/joho/godotenv"
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg"
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/logging"
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/trace"
 )
 
-// Starts orchestrator
+// Starts orchestrator. Config and log level are reloaded when .env changes or on SIGHUP, SIGINT and SIGTERM stop it gracefully
 func main() {
-	if err := godotenv.Load(); err != nil {
-		log.Fatal("Error loading .env file")
+	if err := pkg.LoadEnvFile(".env"); err != nil {
+		fatal("Error loading .env file", err)
+	}
+
+	if err := logging.Setup(os.Stderr, pkg.GetEnvWithDefault("LOG_FORMAT", "json"), pkg.GetEnvWithDefault("LOG_LEVEL", "info")); err != nil {
+		fatal("Error configuring logger", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	exporter, err := trace.NewExporter(pkg.GetEnvWithDefault("TRACE_EXPORTER", ""), pkg.GetEnvWithDefault("TRACE_FILE", ""))
+	if err != nil {
+		fatal("Error creating trace exporter", err)
 	}
 
 	orch := orchestrator.NewOrchestrator()
+	orch.SetTraceExporter(exporter)
+
+	go pkg.WatchEnvFile(ctx, ".env", 2*time.Second, func() {
+		if err := logging.SetLevel(pkg.GetEnvWithDefault("LOG_LEVEL", "info")); err != nil {
+			slog.Error("Error changing log level", "error", err)
+		}
+		orch.Reload()
+	})
+
+	if err := orch.Run(ctx); err != nil {
+		fatal("Failed to start server", err)
+	}
+}
 
-	orch.Run()
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
@@ -1,102 +1,280 @@
 package agent
 
 import (
-	"bytes"
-	"encoding/json"
-	"log"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
-	"sync"
+	"os"
 	"time"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/calc"
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/trace"
+	"github.com/google/uuid"
 )
 
-// NewAgent - Creates new agent with specified constants
-func NewAgent(cntGoroutines, pingTime int) *Agent {
-	return &Agent{
-		cntGoroutines: cntGoroutines,
-		pingTime:      pingTime,
+// NewAgent - Creates new agent with specified config
+func NewAgent(cfg Config) *Agent {
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		cfg.ShutdownTimeout = 30 * time.Second
+	}
+	if cfg.ID == "" {
+		cfg.ID = uuid.New().String()
+	}
+	if cfg.HeartbeatInterval <= 0 {
+		cfg.HeartbeatInterval = 5 * time.Second
+	}
+	if cfg.ScaleInterval <= 0 {
+		cfg.ScaleInterval = 2 * time.Second
+	}
+	if cfg.MinWorkers == 0 && cfg.MaxWorkers == 0 {
+		cfg.MinWorkers, cfg.MaxWorkers = cfg.Workers, cfg.Workers
+	}
+	cfg.MinWorkers, cfg.MaxWorkers = normalizeLimits(cfg.MinWorkers, cfg.MaxWorkers)
+
+	a := &Agent{
+		cntGoroutines:     min(max(cfg.Workers, cfg.MinWorkers), cfg.MaxWorkers),
+		orchestratorURL:   cfg.OrchestratorURL,
+		client:            cfg.Client,
+		shutdownTimeout:   cfg.ShutdownTimeout,
+		scaleInterval:     cfg.ScaleInterval,
+		heartbeatInterval: cfg.HeartbeatInterval,
+		minWorkers:        cfg.MinWorkers,
+		maxWorkers:        cfg.MaxWorkers,
+		tracer:            trace.NewTracer("agent", cfg.TraceExporter),
+		log:               slog.With("agent_id", cfg.ID),
+		id:                cfg.ID,
+		ctx:               context.Background(),
+		workCtx:           context.Background(),
+	}
+	if cfg.Transport == nil {
+		cfg.Transport = &httpTransport{url: cfg.OrchestratorURL, token: cfg.Token, id: cfg.ID, do: a.do}
+	}
+	a.transport = cfg.Transport
+	a.pingTime.Store(int64(cfg.PingTime))
+	a.queueHint.Store(-1)
+	a.metrics = newAgentMetrics(a)
+	return a
+}
+
+// NewHTTPClient - creates client for orchestrator. With certFile and keyFile agent authenticates by client certificate,
+// with caFile it trusts orchestrator certificate signed by that CA
+func NewHTTPClient(certFile, keyFile, caFile string) (*http.Client, error) {
+	if certFile == "" && keyFile == "" && caFile == "" {
+		return http.DefaultClient, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates in CA file")
+		}
+		tlsConfig.RootCAs = pool
 	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Transport: transport}, nil
 }
 
-// Run - starts N workers with WaitGroup in each
-func (a *Agent) Run() {
-	ping = a.pingTime
+// Run - starts N workers, autoscaling of their amount, and blocks until ctx is done. After that workers don't take new tasks and finish current ones.
+// Tasks which are not finished in shutdown timeout are handed back to orchestrator. Trace exporter is closed at the end
+func (a *Agent) Run(ctx context.Context) {
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
 
-	log.Printf("Starting %v workers", a.cntGoroutines)
+	a.mu.Lock()
+	a.ctx = ctx
+	a.workCtx = workCtx
+	a.mu.Unlock()
 
-	var wg sync.WaitGroup
-	for i := 0; i < a.cntGoroutines; i++ {
-		wg.Add(1)
-		go worker(&wg)
+	go func() {
+		<-ctx.Done()
+		a.log.Info("Shutting down: finishing current tasks")
+		timer := time.AfterFunc(a.shutdownTimeout, cancelWork)
+		<-workCtx.Done()
+		timer.Stop()
+	}()
+
+	minWorkers, maxWorkers := a.limits()
+	a.log.Info("Starting workers", "workers", a.cntGoroutines, "min_workers", minWorkers, "max_workers", maxWorkers)
+
+	a.SetWorkers(a.cntGoroutines)
+	go a.autoscale(ctx)
+	go a.heartbeat(ctx)
+	a.wg.Wait()
+
+	a.log.Info("All workers stopped")
+	if err := a.tracer.Close(); err != nil {
+		a.log.Error("Error closing trace exporter", "error", err)
 	}
-	wg.Wait()
 }
 
-// worker - main logic. Get task, calculate it and send task to orchestrator
-func worker(wg *sync.WaitGroup) {
-	defer wg.Done()
+// SetWorkers - scales worker pool. Stopped workers finish and send their current task before exit
+func (a *Agent) SetWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.ctx.Err() != nil {
+		return
+	}
+
+	for len(a.workers) < n {
+		stop := make(chan struct{})
+		a.workers = append(a.workers, stop)
+		a.wg.Add(1)
+		go a.worker(a.ctx, a.workCtx, stop)
+	}
+	for len(a.workers) > n {
+		last := len(a.workers) - 1
+		close(a.workers[last])
+		a.workers = a.workers[:last]
+	}
+
+	a.log.Info("Worker pool resized", "workers", n)
+}
+
+// SetPingTime - changes delay between requests when there is no task
+func (a *Agent) SetPingTime(pingTime int) {
+	a.pingTime.Store(int64(pingTime))
+}
+
+// worker - main logic. Get task, calculate it and send task to orchestrator. Exits only between tasks
+func (a *Agent) worker(ctx, workCtx context.Context, stop <-chan struct{}) {
+	defer a.wg.Done()
+	misses := 0
 	for {
-		task, err := getTask()
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		task, depth, err := a.transport.FetchTask(ctx)
+		if err == nil {
+			a.observe(depth, task != nil)
+		}
 		if err != nil || task == nil {
-			time.Sleep(time.Duration(ping) * time.Millisecond)
+			if err != nil && ctx.Err() == nil {
+				a.log.Warn("Error getting task", "error", err)
+				a.metrics.polls.Inc("error")
+			} else if err == nil {
+				a.metrics.polls.Inc("empty")
+			}
+			select {
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-time.After(a.idleDelay(misses)):
+			}
+			misses++
 			continue
 		}
+		misses = 0
+		a.metrics.polls.Inc("task")
 
-		result := calculate(task.Task)
-
-		log.Printf("Get task: %v %v %v. Result: %v", task.Task.Arg1, task.Task.Operation, task.Task.Arg2, result)
-
-		err = sendTask(task.Task, result)
-		if err != nil {
-			log.Printf("Error sending task: %v", err)
-		}
+		a.execute(workCtx, task)
 	}
 }
 
-// getTask - gets task from orchestrator
-func getTask() (*TaskRequest, error) {
-	resp, err := http.Get("http://localhost:8080/internal/task")
+// execute - calculates task and sends result, or hands task back if workCtx is done earlier
+func (a *Agent) execute(workCtx context.Context, task *TaskRequest) {
+	_, span := a.tracer.Start(trace.ContextWith(workCtx, task.Parent), "agent_execution")
+	span.SetAttr("task.id", task.Task.ID)
+	span.SetAttr("operation", task.Task.Operation)
+	defer span.End()
+
+	logger := a.log.With("task_id", task.Task.ID, "expression_id", task.Task.ExpressionID)
+
+	a.busy.Add(1)
+	start := time.Now()
+	result, err := calculate(workCtx, task.Task)
+	a.metrics.busySeconds.Add(time.Since(start).Seconds())
+	a.busy.Add(-1)
+
 	if err != nil {
-		return nil, err
+		span.SetError(err)
+		a.metrics.tasks.Inc(task.Task.Operation, "released")
+		logger.Warn("Handing back task", "error", err)
+		// not bound to agent context, so tasks are handed back during shutdown too
+		if err := a.transport.ReleaseTask(context.Background(), task.Task); err != nil {
+			logger.Error("Error handing back task", "error", err)
+		}
+		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, err
+	if math.IsInf(result, 0) || math.IsNaN(result) {
+		span.SetError(calc.ErrDivisionByZero)
+		a.metrics.tasks.Inc(task.Task.Operation, "failed")
+		logger.Warn("Task failed", "arg1", task.Task.Arg1, "operation", task.Task.Operation, "arg2", task.Task.Arg2, "error", calc.ErrDivisionByZero)
+		if err := a.transport.FailTask(context.Background(), task.Task, calc.ErrDivisionByZero); err != nil {
+			logger.Error("Error sending task error", "error", err)
+		}
+		return
 	}
 
-	var res *TaskRequest
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return nil, err
-	}
+	logger.Info("Task calculated", "arg1", task.Task.Arg1, "operation", task.Task.Operation, "arg2", task.Task.Arg2, "result", result)
 
-	return res, nil
+	err = a.transport.SendResult(context.Background(), task.Task, result)
+	if err != nil {
+		span.SetError(err)
+		a.metrics.tasks.Inc(task.Task.Operation, "send_error")
+		logger.Error("Error sending task", "error", err)
+		return
+	}
+	a.metrics.tasks.Inc(task.Task.Operation, "completed")
 }
 
-// calculate - wait for operation time and return calculation of two arguments
-func calculate(task Task) float64 {
-	time.Sleep(time.Duration(task.OperationTime) * time.Millisecond)
+// calculate - wait for operation time and return calculation of two arguments. Returns error if ctx is done earlier
+func calculate(ctx context.Context, task Task) (float64, error) {
+	timer := time.NewTimer(time.Duration(task.OperationTime) * time.Millisecond)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+
 	switch task.Operation {
 	case "+":
-		return task.Arg1 + task.Arg2
+		return task.Arg1 + task.Arg2, nil
 	case "-":
-		return task.Arg1 - task.Arg2
+		return task.Arg1 - task.Arg2, nil
 	case "*":
-		return task.Arg1 * task.Arg2
+		return task.Arg1 * task.Arg2, nil
 	case "/":
-		return task.Arg1 / task.Arg2
+		return task.Arg1 / task.Arg2, nil
 	default:
-		return 0
+		return 0, nil
 	}
 }
-
-// sendTask - sends ready task to orchestrator
-func sendTask(task Task, result float64) error {
-	data, _ := json.Marshal(map[string]interface{}{"id": task.ID, "result": result, "expression_id": task.ExpressionID})
-
-	_, err := http.Post("http://localhost:8080/internal/task", "application/json", bytes.NewBuffer(data))
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestScaleTarget(t *testing.T) {
+	tests := []struct {
+		name     string
+		n        int
+		polls    int64
+		hits     int64
+		hint     int64
+		expected int
+	}{
+		{"queue has tasks", 2, 4, 4, 10, 4},
+		{"queue hint limits growth", 4, 4, 4, 1, 5},
+		{"every poll got task without hint", 3, 6, 6, -1, 6},
+		{"queue drained", 4, 8, 8, 0, 4},
+		{"workers busy", 4, 0, 0, -1, 4},
+		{"idle", 8, 10, 0, 0, 4},
+		{"mostly idle", 6, 10, 3, 0, 5},
+		{"bounded by max", 8, 4, 4, 100, 10},
+		{"bounded by min", 3, 10, 0, 0, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scaleTarget(tt.n, 2, 10, tt.polls, tt.hits, tt.hint)
+			if got != tt.expected {
+				t.Errorf("expected %v workers, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestHealthFailures(t *testing.T) {
+	a := &Agent{heartbeatInterval: time.Minute}
+	ok := &http.Response{StatusCode: http.StatusOK}
+	lost := errors.New("connection refused")
+
+	a.recordContact(ok, nil)
+	for i := 1; i < maxContactFailures; i++ {
+		a.recordContact(nil, lost)
+		if h := a.Health(); !h.Connected || h.LastError == "" {
+			t.Fatalf("expected agent to stay connected after %v failures, got %+v", i, h)
+		}
+	}
+	a.recordContact(nil, lost)
+	if h := a.Health(); h.Connected {
+		t.Fatalf("expected agent to be disconnected after %v failures", maxContactFailures)
+	}
+
+	a.recordContact(ok, nil)
+	if h := a.Health(); !h.Connected {
+		t.Fatalf("expected agent to be connected after success, got %+v", h)
+	}
+
+	a.recordContact(&http.Response{StatusCode: http.StatusUnauthorized}, nil)
+	if h := a.Health(); h.Connected {
+		t.Errorf("expected rejected credentials to disconnect at once")
+	}
+}
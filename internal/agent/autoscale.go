@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"context"
+	"time"
+)
+
+// maxIdleBackoff - how many ping intervals idle worker waits at most between requests
+const maxIdleBackoff = 8
+
+// Workers - current size of worker pool
+func (a *Agent) Workers() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.workers)
+}
+
+// SetWorkerLimits - changes bounds of autoscaling and moves pool inside them. With min == max pool has fixed size
+func (a *Agent) SetWorkerLimits(minWorkers, maxWorkers int) {
+	minWorkers, maxWorkers = normalizeLimits(minWorkers, maxWorkers)
+
+	a.mu.Lock()
+	a.minWorkers, a.maxWorkers = minWorkers, maxWorkers
+	n := min(max(len(a.workers), minWorkers), maxWorkers)
+	a.mu.Unlock()
+
+	a.SetWorkers(n)
+}
+
+// limits - current bounds of autoscaling
+func (a *Agent) limits() (int, int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.minWorkers, a.maxWorkers
+}
+
+// normalizeLimits - makes 1 <= min <= max
+func normalizeLimits(minWorkers, maxWorkers int) (int, int) {
+	minWorkers = max(minWorkers, 1)
+	maxWorkers = max(maxWorkers, minWorkers)
+	return minWorkers, maxWorkers
+}
+
+// observe - records result of one FetchTask and queue depth hint from orchestrator, -1 if it is unknown
+func (a *Agent) observe(depth int64, gotTask bool) {
+	a.polls.Add(1)
+	if gotTask {
+		a.hits.Add(1)
+	}
+
+	if depth >= 0 {
+		a.queueHint.Store(depth)
+	}
+}
+
+// idleDelay - delay before next request of worker which got no task several times in a row
+func (a *Agent) idleDelay(misses int) time.Duration {
+	backoff := min(int64(1)<<min(misses, 10), maxIdleBackoff)
+	return time.Duration(a.pingTime.Load()*backoff) * time.Millisecond
+}
+
+// autoscale - every interval compares how many polls returned work and resizes pool between min and max workers
+func (a *Agent) autoscale(ctx context.Context) {
+	ticker := time.NewTicker(a.scaleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		minWorkers, maxWorkers := a.limits()
+		if minWorkers == maxWorkers {
+			continue
+		}
+
+		polls, hits, hint := a.polls.Swap(0), a.hits.Swap(0), a.queueHint.Swap(-1)
+		n := a.Workers()
+
+		target := scaleTarget(n, minWorkers, maxWorkers, polls, hits, hint)
+		if target == n {
+			continue
+		}
+
+		a.log.Info("Scaling workers", "from", n, "to", target, "polls", polls, "hits", hits, "queue_depth", hint)
+		a.SetWorkers(target)
+	}
+}
+
+// scaleTarget - new pool size. Grows up to twice while orchestrator has queued tasks or every poll gets task,
+// halves when no poll got task and shrinks by one when less than half of polls got task. Without polls all workers are busy.
+// hint is queue depth reported by orchestrator or -1 if unknown
+func scaleTarget(n, minWorkers, maxWorkers int, polls, hits, hint int64) int {
+	target := n
+
+	switch {
+	case hint > 0:
+		target = n + int(min(hint, int64(n)))
+	case polls == 0:
+	case hint < 0 && polls > 0 && hits == polls:
+		target = n * 2
+	case hits == 0:
+		target = n / 2
+	case hits*2 < polls:
+		target = n - 1
+	}
+
+	return min(max(target, minWorkers), maxWorkers)
+}
@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Health - state of agent and its connection to orchestrator
+type Health struct {
+	Status       string     `json:"status"`
+	ID           string     `json:"id"`
+	Orchestrator string     `json:"orchestrator"`
+	Connected    bool       `json:"connected"`
+	LastContact  *time.Time `json:"last_contact,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	Workers      int        `json:"workers"`
+	Busy         int        `json:"busy"`
+}
+
+// maxContactFailures - failed requests in a row after which agent is not connected. One failed poll is not enough
+const maxContactFailures = 3
+
+// recordContact - remembers result of request to orchestrator. Rejected credentials count as lost connection at once
+func (a *Agent) recordContact(resp *http.Response, err error) {
+	rejected := err == nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden)
+	if rejected {
+		err = fmt.Errorf("orchestrator rejected credentials: %v", resp.StatusCode)
+	}
+
+	a.contactMu.Lock()
+	defer a.contactMu.Unlock()
+	if err != nil {
+		a.lastError = err.Error()
+		a.failures++
+		if rejected {
+			a.failures = max(a.failures, maxContactFailures)
+		}
+		return
+	}
+	a.lastContact = time.Now()
+	a.lastError = ""
+	a.failures = 0
+}
+
+// Health - agent is healthy while some request reached orchestrator within three heartbeat intervals
+// and the last maxContactFailures requests didn't all fail
+func (a *Agent) Health() Health {
+	a.contactMu.Lock()
+	lastContact, lastError, failures := a.lastContact, a.lastError, a.failures
+	a.contactMu.Unlock()
+
+	h := Health{
+		Status:       "ok",
+		ID:           a.id,
+		Orchestrator: a.orchestratorURL,
+		Connected:    failures < maxContactFailures && !lastContact.IsZero() && time.Since(lastContact) <= 3*a.heartbeatInterval,
+		LastError:    lastError,
+		Workers:      a.Workers(),
+		Busy:         int(a.busy.Load()),
+	}
+	if !lastContact.IsZero() {
+		h.LastContact = &lastContact
+	}
+	if !h.Connected {
+		h.Status = "unavailable"
+	}
+	return h
+}
+
+// healthzHandler - returns 200 when orchestrator is reachable and 503 otherwise
+func (a *Agent) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	h := a.Health()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !h.Connected {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(h)
+}
+
+// heartbeat - reports pool size to orchestrator every interval, so it knows agent is alive even when all workers are busy
+func (a *Agent) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(a.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		hb := Heartbeat{ID: a.id, Workers: a.Workers(), Busy: int(a.busy.Load())}
+		if err := a.transport.Heartbeat(context.Background(), hb); err != nil {
+			a.log.Warn("Error sending heartbeat", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/metrics"
+)
+
+// agentMetrics - metrics of agent served on /metrics
+type agentMetrics struct {
+	registry *metrics.Registry
+
+	polls           *metrics.Counter
+	tasks           *metrics.Counter
+	busySeconds     *metrics.Counter
+	requestDuration *metrics.Histogram
+}
+
+// newAgentMetrics - registers metrics of agent. Utilization is rate(calc_agent_busy_seconds_total) / calc_agent_workers
+func newAgentMetrics(a *Agent) *agentMetrics {
+	r := metrics.NewRegistry()
+	m := &agentMetrics{
+		registry:        r,
+		polls:           r.Counter("calc_agent_polls_total", "Requests for task by result.", "result"),
+		tasks:           r.Counter("calc_agent_tasks_total", "Tasks taken from orchestrator by operation and outcome.", "operation", "status"),
+		busySeconds:     r.Counter("calc_agent_busy_seconds_total", "Time workers spent calculating tasks."),
+		requestDuration: r.Histogram("calc_agent_request_duration_seconds", "Duration of requests to orchestrator.", nil, "method", "path", "code"),
+	}
+
+	r.GaugeFunc("calc_agent_workers", "Current size of worker pool.", func() float64 { return float64(a.Workers()) })
+	r.GaugeFunc("calc_agent_workers_busy", "Workers calculating task right now.", func() float64 { return float64(a.busy.Load()) })
+	r.GaugeFunc("calc_agent_workers_min", "Lower bound of autoscaling.", func() float64 {
+		minWorkers, _ := a.limits()
+		return float64(minWorkers)
+	})
+	r.GaugeFunc("calc_agent_workers_max", "Upper bound of autoscaling.", func() float64 {
+		_, maxWorkers := a.limits()
+		return float64(maxWorkers)
+	})
+
+	return m
+}
+
+// Handler - HTTP API of agent with /metrics and /healthz
+func (a *Agent) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", a.metrics.registry.Handler())
+	mux.HandleFunc("GET /healthz", a.healthzHandler)
+	return mux
+}
+
+// do - sends request to orchestrator and measures its duration
+func (a *Agent) do(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := a.client.Do(req)
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	a.metrics.requestDuration.Observe(time.Since(start).Seconds(), req.Method, req.URL.Path, code)
+	if req.Context().Err() == nil {
+		a.recordContact(resp, err)
+	}
+
+	return resp, err
+}
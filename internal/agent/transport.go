@@ -0,0 +1,141 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/trace"
+)
+
+// Transport - connection of agent to orchestrator. By default agent uses internal HTTP API,
+// embedded agents call orchestrator in the same process
+type Transport interface {
+	// FetchTask - takes next task. Returns nil if there are no tasks, and queue depth or -1 if it is unknown
+	FetchTask(ctx context.Context) (*TaskRequest, int64, error)
+	// SendResult - delivers result of calculated task
+	SendResult(ctx context.Context, task Task, result float64) error
+	// FailTask - reports task which can't be calculated, e.g. division by zero. Orchestrator fails its expression
+	FailTask(ctx context.Context, task Task, err error) error
+	// ReleaseTask - returns task which agent won't calculate, so orchestrator gives it to another agent
+	ReleaseTask(ctx context.Context, task Task) error
+	// Heartbeat - reports state of agent
+	Heartbeat(ctx context.Context, hb Heartbeat) error
+}
+
+// httpTransport - internal API of orchestrator. Requests are executed by do, which records metrics and connection state
+type httpTransport struct {
+	url   string
+	token string
+	id    string
+	do    func(req *http.Request) (*http.Response, error)
+}
+
+// newRequest - creates request to internal API of orchestrator with agent credentials
+func (t *httpTransport) newRequest(ctx context.Context, method, path string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, t.url+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("X-Agent-ID", t.id)
+	if t.token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+	return req, nil
+}
+
+// FetchTask - gets task from orchestrator. Queue depth is taken from X-Queue-Depth header
+func (t *httpTransport) FetchTask(ctx context.Context) (*TaskRequest, int64, error) {
+	req, err := t.newRequest(ctx, http.MethodGet, "/internal/task", nil)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	resp, err := t.do(req)
+	if err != nil {
+		return nil, -1, err
+	}
+	defer resp.Body.Close()
+
+	depth, err := strconv.ParseInt(resp.Header.Get("X-Queue-Depth"), 10, 64)
+	if err != nil {
+		depth = -1
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, depth, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, depth, fmt.Errorf("unexpected status %v", resp.StatusCode)
+	}
+
+	var res *TaskRequest
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, depth, err
+	}
+	if res != nil {
+		res.Parent, _ = trace.Extract(resp.Header)
+	}
+
+	return res, depth, nil
+}
+
+// SendResult - sends ready task to orchestrator
+func (t *httpTransport) SendResult(ctx context.Context, task Task, result float64) error {
+	data, err := json.Marshal(map[string]interface{}{"id": task.ID, "result": result, "expression_id": task.ExpressionID})
+	if err != nil {
+		return err
+	}
+	return t.post(ctx, "/internal/task", data)
+}
+
+// FailTask - sends error of task to orchestrator instead of result
+func (t *httpTransport) FailTask(ctx context.Context, task Task, taskErr error) error {
+	data, err := json.Marshal(map[string]interface{}{"id": task.ID, "error": taskErr.Error(), "expression_id": task.ExpressionID})
+	if err != nil {
+		return err
+	}
+	return t.post(ctx, "/internal/task", data)
+}
+
+// ReleaseTask - hands back task to orchestrator
+func (t *httpTransport) ReleaseTask(ctx context.Context, task Task) error {
+	data, _ := json.Marshal(map[string]interface{}{"id": task.ID, "expression_id": task.ExpressionID})
+	return t.post(ctx, "/internal/task/release", data)
+}
+
+// Heartbeat - sends pool size of agent
+func (t *httpTransport) Heartbeat(ctx context.Context, hb Heartbeat) error {
+	data, _ := json.Marshal(hb)
+	return t.post(ctx, "/internal/heartbeat", data)
+}
+
+// post - sends data to internal API with timeout
+func (t *httpTransport) post(ctx context.Context, path string, data []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := t.newRequest(ctx, http.MethodPost, path, data)
+	if err != nil {
+		return err
+	}
+
+	resp, err := t.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %v", resp.StatusCode)
+	}
+
+	return nil
+}
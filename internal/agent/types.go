@@ -1,5 +1,16 @@
 package agent
 
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/trace"
+)
+
 type Task struct {
 	ID            string  `json:"id"`
 	Arg1          float64 `json:"arg1"`
@@ -11,11 +22,66 @@ type Task struct {
 
 type TaskRequest struct {
 	Task Task `json:"task"`
+
+	// Parent - span of task in orchestrator, spans of agent are its children
+	Parent trace.SpanContext `json:"-"`
 }
 
-type Agent struct {
-	cntGoroutines int
-	pingTime      int
+// Heartbeat - state of agent reported to orchestrator
+type Heartbeat struct {
+	ID      string `json:"id"`
+	Workers int    `json:"workers"`
+	Busy    int    `json:"busy"`
+}
+
+// Config - settings of agent. Pool starts with Workers and scales between MinWorkers and MaxWorkers,
+// zero MinWorkers and MaxWorkers mean fixed pool of Workers. Without Transport agent uses HTTP API at OrchestratorURL
+type Config struct {
+	ID                string
+	Workers           int
+	MinWorkers        int
+	MaxWorkers        int
+	ScaleInterval     time.Duration
+	HeartbeatInterval time.Duration
+	PingTime          int
+	OrchestratorURL   string
+	Token             string
+	Client            *http.Client
+	Transport         Transport
+	ShutdownTimeout   time.Duration
+	TraceExporter     trace.Exporter
 }
 
-var ping int
+type Agent struct {
+	cntGoroutines     int
+	pingTime          atomic.Int64
+	orchestratorURL   string
+	client            *http.Client
+	transport         Transport
+	shutdownTimeout   time.Duration
+	scaleInterval     time.Duration
+	heartbeatInterval time.Duration
+
+	polls     atomic.Int64
+	hits      atomic.Int64
+	queueHint atomic.Int64
+	busy      atomic.Int64
+	metrics   *agentMetrics
+	tracer    *trace.Tracer
+	log       *slog.Logger
+	id        string
+
+	mu         sync.Mutex
+	ctx        context.Context
+	workCtx    context.Context
+	workers    []chan struct{}
+	minWorkers int
+	maxWorkers int
+	wg         sync.WaitGroup
+
+	contactMu   sync.Mutex
+	lastContact time.Time
+	lastError   string
+	// failures - failed requests in a row since last successful one
+	failures int
+}
@@ -0,0 +1,175 @@
+package orchestrator
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+)
+
+const apiKeyPrefix = "ck_"
+
+var (
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	ErrInvalidScope  = errors.New("invalid scope")
+)
+
+// hashAPIKey - keys are random, so sha256 is enough to not store them in plain text
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// validScope - checks if scope is known
+func validScope(scope string) bool {
+	return scope == ScopeSubmit || scope == ScopeRead || scope == ScopeAdmin
+}
+
+// createAPIKey - generates new key and saves its hash. Plain key is returned only once
+func (o *Orchestrator) createAPIKey(req APIKeyRequest) (string, *APIKey, error) {
+	if len(req.Scopes) == 0 {
+		return "", nil, ErrInvalidScope
+	}
+	for _, scope := range req.Scopes {
+		if !validScope(scope) {
+			return "", nil, ErrInvalidScope
+		}
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	key := apiKeyPrefix + hex.EncodeToString(buf)
+
+	apiKey := &APIKey{
+		ID:        o.newID(),
+		Name:      req.Name,
+		Prefix:    key[:len(apiKeyPrefix)+6],
+		Scopes:    req.Scopes,
+		OwnerID:   req.OwnerID,
+		RateLimit: req.RateLimit,
+		Burst:     req.Burst,
+		CreatedAt: o.clock.Now(),
+	}
+	if apiKey.OwnerID == "" {
+		apiKey.OwnerID = apiKey.ID
+	}
+
+	o.saveAPIKey(key, apiKey)
+
+	return key, apiKey, nil
+}
+
+// saveAPIKey - stores key by hash
+func (o *Orchestrator) saveAPIKey(key string, apiKey *APIKey) {
+	o.apiKeysMu.Lock()
+	defer o.apiKeysMu.Unlock()
+	apiKey.hash = hashAPIKey(key)
+	o.apiKeys[apiKey.hash] = apiKey
+}
+
+// lookupAPIKey - finds not revoked key
+func (o *Orchestrator) lookupAPIKey(key string) (*APIKey, error) {
+	o.apiKeysMu.Lock()
+	defer o.apiKeysMu.Unlock()
+
+	apiKey, ok := o.apiKeys[hashAPIKey(key)]
+	if !ok || apiKey.RevokedAt != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	return apiKey, nil
+}
+
+// loadAdminKey - registers admin key from env, so the first keys can be created
+func (o *Orchestrator) loadAdminKey(key string) {
+	if key == "" {
+		return
+	}
+	o.saveAPIKey(key, &APIKey{
+		ID:        "admin",
+		Name:      "ADMIN_API_KEY",
+		Scopes:    []string{ScopeAdmin},
+		OwnerID:   "admin",
+		CreatedAt: o.clock.Now(),
+	})
+}
+
+// createAPIKeyHandler - creates new API key
+func (o *Orchestrator) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RateLimit < 0 || req.Burst < 0 {
+		http.Error(w, "Invalid request body", http.StatusUnprocessableEntity)
+		return
+	}
+
+	key, apiKey, err := o.createAPIKey(req)
+	if errors.Is(err, ErrInvalidScope) {
+		http.Error(w, "Invalid scopes", http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	slog.InfoContext(r.Context(), "API key created", "key_id", apiKey.ID, "name", apiKey.Name, "owner_id", apiKey.OwnerID)
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"key": key, "api_key": apiKey}); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// getAPIKeysHandler - returns all API keys without their secrets
+func (o *Orchestrator) getAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	o.apiKeysMu.Lock()
+	keyList := make([]APIKey, 0, len(o.apiKeys))
+	for _, apiKey := range o.apiKeys {
+		keyList = append(keyList, *apiKey)
+	}
+	o.apiKeysMu.Unlock()
+
+	sort.Slice(keyList, func(i, j int) bool {
+		return keyList[i].CreatedAt.Before(keyList[j].CreatedAt)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"api_keys": keyList}); err != nil {
+		http.Error(w, "Error encoding API keys", http.StatusInternalServerError)
+		return
+	}
+}
+
+// revokeAPIKeyHandler - revokes API key with ID
+func (o *Orchestrator) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	keyID := mux.Vars(r)["id"]
+
+	o.apiKeysMu.Lock()
+	defer o.apiKeysMu.Unlock()
+
+	for _, apiKey := range o.apiKeys {
+		if apiKey.ID != keyID {
+			continue
+		}
+		if apiKey.RevokedAt == nil {
+			now := o.clock.Now()
+			apiKey.RevokedAt = &now
+			slog.InfoContext(r.Context(), "API key revoked", "key_id", apiKey.ID)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	http.Error(w, "API key not found", http.StatusNotFound)
+}
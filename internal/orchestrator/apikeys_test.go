@@ -0,0 +1,154 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/clock"
+)
+
+// apiKey - header with API key
+func apiKey(key string) map[string]string {
+	return map[string]string{"X-API-Key": key}
+}
+
+// createKey - creates API key through admin API and returns plain key and its ID
+func createKey(t *testing.T, h http.Handler, body string) (string, string) {
+	t.Helper()
+
+	rec := doRequest(h, http.MethodPost, "/api/v1/admin/keys", body, apiKey("admin-key"))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected key to be created, got %v: %v", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Key    string `json:"key"`
+		APIKey APIKey `json:"api_key"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Key, resp.APIKey.ID
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	o := NewOrchestrator(WithClock(clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))))
+	o.loadAdminKey("admin-key")
+	h := o.Handler()
+
+	reader, _ := createKey(t, h, `{"name": "reader", "scopes": ["read"]}`)
+	submitter, _ := createKey(t, h, `{"name": "submitter", "scopes": ["submit"]}`)
+	user := login(t, h, "alice")
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		header   map[string]string
+		expected int
+	}{
+		{name: "Read with read scope", method: http.MethodGet, path: "/api/v1/expressions", header: apiKey(reader), expected: http.StatusOK},
+		{name: "Submit with read scope", method: http.MethodPost, path: "/api/v1/calculate", body: `{"expression": "1+1"}`, header: apiKey(reader), expected: http.StatusForbidden},
+		{name: "Submit with submit scope", method: http.MethodPost, path: "/api/v1/calculate", body: `{"expression": "1+1"}`, header: apiKey(submitter), expected: http.StatusCreated},
+		{name: "Read with submit scope", method: http.MethodGet, path: "/api/v1/expressions", header: apiKey(submitter), expected: http.StatusForbidden},
+		{name: "Admin with read scope", method: http.MethodGet, path: "/api/v1/admin/keys", header: apiKey(reader), expected: http.StatusForbidden},
+		{name: "Admin with user token", method: http.MethodGet, path: "/api/v1/admin/config", header: bearer(user), expected: http.StatusForbidden},
+		{name: "Debug state with user token", method: http.MethodGet, path: "/debug/state", header: bearer(user), expected: http.StatusForbidden},
+		{name: "Admin key allows everything", method: http.MethodGet, path: "/api/v1/expressions", header: apiKey("admin-key"), expected: http.StatusOK},
+		{name: "Unknown key", method: http.MethodGet, path: "/api/v1/expressions", header: apiKey("ck_unknown"), expected: http.StatusUnauthorized},
+		{name: "Unknown scope", method: http.MethodPost, path: "/api/v1/admin/keys", body: `{"scopes": ["root"]}`, header: apiKey("admin-key"), expected: http.StatusUnprocessableEntity},
+		{name: "Without scopes", method: http.MethodPost, path: "/api/v1/admin/keys", body: `{"name": "empty"}`, header: apiKey("admin-key"), expected: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := doRequest(h, tt.method, tt.path, tt.body, tt.header); rec.Code != tt.expected {
+				t.Errorf("expected %v, got %v: %v", tt.expected, rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	o := NewOrchestrator(WithClock(clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))))
+	o.loadAdminKey("admin-key")
+	h := o.Handler()
+
+	key, id := createKey(t, h, `{"name": "reader", "scopes": ["read"]}`)
+	if rec := doRequest(h, http.MethodGet, "/api/v1/expressions", "", apiKey(key)); rec.Code != http.StatusOK {
+		t.Fatalf("expected key to work before revoke, got %v", rec.Code)
+	}
+
+	if rec := doRequest(h, http.MethodDelete, "/api/v1/admin/keys/"+id, "", apiKey("admin-key")); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %v: %v", rec.Code, rec.Body)
+	}
+	if rec := doRequest(h, http.MethodGet, "/api/v1/expressions", "", apiKey(key)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected revoked key to be rejected, got %v", rec.Code)
+	}
+	if rec := doRequest(h, http.MethodDelete, "/api/v1/admin/keys/"+id, "", apiKey("admin-key")); rec.Code != http.StatusNoContent {
+		t.Errorf("expected repeated revoke to succeed, got %v", rec.Code)
+	}
+	if rec := doRequest(h, http.MethodDelete, "/api/v1/admin/keys/missing", "", apiKey("admin-key")); rec.Code != http.StatusNotFound {
+		t.Errorf("expected unknown key not to be found, got %v", rec.Code)
+	}
+
+	// list shows revoked key, but never its secret
+	rec := doRequest(h, http.MethodGet, "/api/v1/admin/keys", "", apiKey("admin-key"))
+	if strings.Contains(rec.Body.String(), key) {
+		t.Errorf("expected list not to contain plain key")
+	}
+	var resp struct {
+		APIKeys []APIKey `json:"api_keys"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range resp.APIKeys {
+		if k.ID == id && k.RevokedAt == nil {
+			t.Errorf("expected key to be listed as revoked, got %+v", k)
+		}
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	o := NewOrchestrator(WithClock(fake))
+	o.loadAdminKey("admin-key")
+	o.rateLimits = rateLimitConfig{keyRate: 100, keyBurst: 100, ipRate: 100, ipBurst: 100}
+	h := o.Handler()
+
+	key, _ := createKey(t, h, `{"name": "slow", "scopes": ["submit"], "rate_limit": 0.5, "burst": 2}`)
+	calculate := func() *http.Response {
+		return doRequest(h, http.MethodPost, "/api/v1/calculate", `{"expression": "1+1"}`, apiKey(key)).Result()
+	}
+
+	for i := 0; i < 2; i++ {
+		if resp := calculate(); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("expected request %v to be allowed by burst, got %v", i, resp.StatusCode)
+		}
+	}
+	resp := calculate()
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "2" {
+		t.Fatalf("expected 429 with Retry-After 2, got %v %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	fake.Advance(2 * time.Second)
+	if resp := calculate(); resp.StatusCode != http.StatusCreated {
+		t.Errorf("expected request to be allowed after Retry-After, got %v", resp.StatusCode)
+	}
+
+	// limit of IP is shared by all callers from it
+	o.rateLimits = rateLimitConfig{ipRate: 1, ipBurst: 1}
+	fake.Advance(time.Minute)
+	alice, bob := login(t, h, "alice"), login(t, h, "bob")
+	if rec := doRequest(h, http.MethodPost, "/api/v1/calculate", `{"expression": "1+1"}`, bearer(alice)); rec.Code != http.StatusCreated {
+		t.Fatalf("expected first request from IP to be allowed, got %v", rec.Code)
+	}
+	rec := doRequest(h, http.MethodPost, "/api/v1/calculate", `{"expression": "1+1"}`, bearer(bob))
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected 429 with Retry-After 1 for the same IP, got %v %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
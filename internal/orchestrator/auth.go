@@ -0,0 +1,256 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type contextKey string
+
+const principalKey contextKey = "principal"
+
+const (
+	ScopeSubmit = "submit"
+	ScopeRead   = "read"
+	ScopeAdmin  = "admin"
+)
+
+// Principal - authenticated caller: user with JWT or API key
+type Principal struct {
+	OwnerID   string
+	KeyID     string
+	Scopes    []string
+	RateLimit float64
+	Burst     int
+}
+
+// hasScope - checks if caller is allowed to use scope. Admin scope allows everything
+func (p *Principal) hasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	ErrUserExists         = errors.New("user already exists")
+	ErrInvalidCredentials = errors.New("invalid login or password")
+)
+
+// passwordCost - bcrypt cost of password hashes, tests lower it to run faster
+var passwordCost = bcrypt.DefaultCost
+
+// loadAuthEnv - loads JWT secret and token lifetime from env. If secret is not set, random one generated at start is kept
+func (o *Orchestrator) loadAuthEnv(secret string, ttlMinutes int) {
+	if secret == "" {
+		slog.Warn("JWT_SECRET is not set, using random secret. Tokens will be invalid after restart")
+	} else {
+		o.jwtSecret = []byte(secret)
+	}
+	o.tokenTTL = time.Duration(ttlMinutes) * time.Minute
+}
+
+// createUser - saves new user with bcrypt hash of password
+func (o *Orchestrator) createUser(login, password string) (*User, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return nil, err
+	}
+
+	o.usersMu.Lock()
+	defer o.usersMu.Unlock()
+
+	if _, exists := o.users[login]; exists {
+		return nil, ErrUserExists
+	}
+
+	user := &User{
+		ID:           o.newID(),
+		Login:        login,
+		passwordHash: hash,
+	}
+	o.users[login] = user
+
+	return user, nil
+}
+
+// authenticate - checks login and password of user
+func (o *Orchestrator) authenticate(login, password string) (*User, error) {
+	o.usersMu.Lock()
+	user, ok := o.users[login]
+	o.usersMu.Unlock()
+
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword(user.passwordHash, []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
+// issueToken - creates signed JWT access token for user
+func (o *Orchestrator) issueToken(user *User) (string, time.Time, error) {
+	now := o.clock.Now()
+	expiresAt := now.Add(o.tokenTTL)
+	claims := jwt.RegisteredClaims{
+		Subject:   user.ID,
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+		IssuedAt:  jwt.NewNumericDate(now),
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(o.jwtSecret)
+	return token, expiresAt, err
+}
+
+// parseToken - validates JWT access token and returns ID of user
+func (o *Orchestrator) parseToken(tokenString string) (string, error) {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		return o.jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithTimeFunc(o.clock.Now))
+	if err != nil {
+		return "", err
+	}
+	return claims.Subject, nil
+}
+
+// bearerToken - gets token from "Authorization: Bearer <token>" header
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// authMiddleware - allows only requests with valid access token or API key and puts caller to request context
+func (o *Orchestrator) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var principal *Principal
+
+		if key := r.Header.Get("X-API-Key"); key != "" {
+			apiKey, err := o.lookupAPIKey(key)
+			if err != nil {
+				http.Error(w, "Invalid API key", http.StatusUnauthorized)
+				return
+			}
+			principal = &Principal{
+				OwnerID:   apiKey.OwnerID,
+				KeyID:     apiKey.ID,
+				Scopes:    apiKey.Scopes,
+				RateLimit: apiKey.RateLimit,
+				Burst:     apiKey.Burst,
+			}
+		} else {
+			token := bearerToken(r)
+			if token == "" {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			userID, err := o.parseToken(token)
+			if err != nil {
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
+			principal = &Principal{OwnerID: userID, Scopes: []string{ScopeSubmit, ScopeRead}}
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey, principal)))
+	})
+}
+
+// requireScope - allows request only if caller has scope
+func requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal := principalFromContext(r.Context())
+		if principal == nil || !principal.hasScope(scope) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// principalFromContext - returns authenticated caller
+func principalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey).(*Principal)
+	return principal
+}
+
+// userIDFromContext - returns ID of owner of authenticated caller
+func userIDFromContext(ctx context.Context) string {
+	if principal := principalFromContext(ctx); principal != nil {
+		return principal.OwnerID
+	}
+	return ""
+}
+
+// registerHandler - creates new user
+func (o *Orchestrator) registerHandler(w http.ResponseWriter, r *http.Request) {
+	var req AuthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Login == "" || req.Password == "" {
+		http.Error(w, "Invalid request body", http.StatusUnprocessableEntity)
+		return
+	}
+
+	user, err := o.createUser(req.Login, req.Password)
+	if errors.Is(err, ErrUserExists) {
+		http.Error(w, "User already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	slog.InfoContext(r.Context(), "User registered", "user_id", user.ID, "login", user.Login)
+
+	if err := json.NewEncoder(w).Encode(map[string]string{"id": user.ID}); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// loginHandler - checks password of user and returns access token
+func (o *Orchestrator) loginHandler(w http.ResponseWriter, r *http.Request) {
+	var req AuthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusUnprocessableEntity)
+		return
+	}
+
+	user, err := o.authenticate(req.Login, req.Password)
+	if err != nil {
+		http.Error(w, "Invalid login or password", http.StatusUnauthorized)
+		return
+	}
+
+	token, expiresAt, err := o.issueToken(user)
+	if err != nil {
+		http.Error(w, "Failed to create token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"token": token, "expires_at": expiresAt}); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
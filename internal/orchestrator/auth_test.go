@@ -0,0 +1,186 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/clock"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func init() {
+	passwordCost = bcrypt.MinCost
+}
+
+// doRequest - sends request to handler. Header values are set as is, e.g. "Authorization" or "X-API-Key"
+func doRequest(h http.Handler, method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// bearer - authorization header with access token
+func bearer(token string) map[string]string {
+	return map[string]string{"Authorization": "Bearer " + token}
+}
+
+// login - registers user and returns its access token
+func login(t *testing.T, h http.Handler, name string) string {
+	t.Helper()
+
+	credentials := `{"login": "` + name + `", "password": "secret-` + name + `"}`
+	if rec := doRequest(h, http.MethodPost, "/api/v1/register", credentials, nil); rec.Code != http.StatusCreated {
+		t.Fatalf("expected %v to be registered, got %v: %v", name, rec.Code, rec.Body)
+	}
+
+	rec := doRequest(h, http.MethodPost, "/api/v1/login", credentials, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected %v to log in, got %v: %v", name, rec.Code, rec.Body)
+	}
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.Token == "" {
+		t.Fatalf("expected token, got %v (%v)", rec.Body, err)
+	}
+	return resp.Token
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	o := NewOrchestrator()
+	h := o.Handler()
+
+	login(t, h, "alice")
+
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		expected int
+	}{
+		{name: "Existing login", path: "/api/v1/register", body: `{"login": "alice", "password": "other"}`, expected: http.StatusConflict},
+		{name: "Empty password", path: "/api/v1/register", body: `{"login": "bob"}`, expected: http.StatusUnprocessableEntity},
+		{name: "Invalid body", path: "/api/v1/register", body: `{`, expected: http.StatusUnprocessableEntity},
+		{name: "Wrong password", path: "/api/v1/login", body: `{"login": "alice", "password": "secret"}`, expected: http.StatusUnauthorized},
+		{name: "Unknown login", path: "/api/v1/login", body: `{"login": "bob", "password": "secret-bob"}`, expected: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := doRequest(h, http.MethodPost, tt.path, tt.body, nil); rec.Code != tt.expected {
+				t.Errorf("expected %v, got %v: %v", tt.expected, rec.Code, rec.Body)
+			}
+		})
+	}
+
+	// only bcrypt hash of password is kept
+	user := o.users["alice"]
+	if string(user.passwordHash) == "secret-alice" {
+		t.Fatal("expected password not to be stored as is")
+	}
+	if err := bcrypt.CompareHashAndPassword(user.passwordHash, []byte("secret-alice")); err != nil {
+		t.Errorf("expected bcrypt hash of password, got %v", err)
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	o := NewOrchestrator(WithClock(fake))
+	o.loadAuthEnv("jwt-secret", 60)
+	h := o.Handler()
+
+	token := login(t, h, "alice")
+	if rec := doRequest(h, http.MethodGet, "/api/v1/expressions", "", bearer(token)); rec.Code != http.StatusOK {
+		t.Fatalf("expected fresh token to be accepted, got %v", rec.Code)
+	}
+
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   "alice",
+		ExpiresAt: jwt.NewNumericDate(fake.Now().Add(time.Hour)),
+	}).SignedString([]byte("other-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake.Advance(59 * time.Minute)
+	if rec := doRequest(h, http.MethodGet, "/api/v1/expressions", "", bearer(token)); rec.Code != http.StatusOK {
+		t.Errorf("expected token to be valid before expiry, got %v", rec.Code)
+	}
+
+	fake.Advance(2 * time.Minute)
+	tests := []struct {
+		name   string
+		header map[string]string
+	}{
+		{name: "Expired token", header: bearer(token)},
+		{name: "Other secret", header: bearer(forged)},
+		{name: "Garbage", header: bearer("not-a-token")},
+		{name: "Without token", header: nil},
+		{name: "Other scheme", header: map[string]string{"Authorization": "Basic " + token}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := doRequest(h, http.MethodGet, "/api/v1/expressions", "", tt.header); rec.Code != http.StatusUnauthorized {
+				t.Errorf("expected 401, got %v", rec.Code)
+			}
+		})
+	}
+}
+
+func TestOwnerScoping(t *testing.T) {
+	o := NewOrchestrator(WithClock(clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))))
+	h := o.Handler()
+	alice, bob := login(t, h, "alice"), login(t, h, "bob")
+
+	rec := doRequest(h, http.MethodPost, "/api/v1/calculate", `{"expression": "2*3"}`, bearer(alice))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %v: %v", rec.Code, rec.Body)
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(token string) []*Expression {
+		t.Helper()
+		var resp struct {
+			Expressions []*Expression `json:"expressions"`
+		}
+		rec := doRequest(h, http.MethodGet, "/api/v1/expressions", "", bearer(token))
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Expressions
+	}
+	if got := list(alice); len(got) != 1 || got[0].ID != created.ID {
+		t.Errorf("expected own expression in list, got %+v", got)
+	}
+	if got := list(bob); len(got) != 0 {
+		t.Errorf("expected expression of other user not to be listed, got %+v", got)
+	}
+
+	path := "/api/v1/expressions/" + created.ID
+	if rec := doRequest(h, http.MethodGet, path, "", bearer(alice)); rec.Code != http.StatusOK {
+		t.Errorf("expected owner to get expression, got %v", rec.Code)
+	}
+	if rec := doRequest(h, http.MethodGet, path, "", bearer(bob)); rec.Code != http.StatusNotFound {
+		t.Errorf("expected expression of other user not to be found, got %v", rec.Code)
+	}
+	if rec := doRequest(h, http.MethodDelete, path, "", bearer(bob)); rec.Code != http.StatusNotFound {
+		t.Errorf("expected expression of other user not to be cancelled, got %v", rec.Code)
+	}
+	if expr, _ := o.Expression(created.ID); expr.Status == StatusCancelled {
+		t.Errorf("expected expression to stay active")
+	}
+}
@@ -0,0 +1,164 @@
+package orchestrator
+
+import (
+	"container/list"
+	"strconv"
+	"sync"
+)
+
+// resultCache - LRU cache of task results with deduplication of identical tasks in flight
+type resultCache struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List
+	inflight map[string]*Task
+
+	hits         uint64
+	inflightHits uint64
+	misses       uint64
+}
+
+type cacheEntry struct {
+	key    string
+	result float64
+}
+
+type CacheStats struct {
+	Size         int     `json:"size"`
+	Capacity     int     `json:"capacity"`
+	Hits         uint64  `json:"hits"`
+	InflightHits uint64  `json:"inflight_hits"`
+	Misses       uint64  `json:"misses"`
+	HitRate      float64 `json:"hit_rate"`
+}
+
+// newResultCache - creates cache which keeps at most capacity results
+func newResultCache(capacity int) *resultCache {
+	return &resultCache{
+		capacity: capacity,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+		inflight: make(map[string]*Task),
+	}
+}
+
+// taskKey - hash of task by operation and arguments
+func taskKey(operation string, arg1, arg2 float64) string {
+	return operation + "|" + strconv.FormatFloat(arg1, 'g', -1, 64) + "|" + strconv.FormatFloat(arg2, 'g', -1, 64)
+}
+
+// acquire - returns cached result or identical task in flight. If there is neither, task becomes the leader for key
+func (c *resultCache) acquire(key string, task *Task) (float64, *Task, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.hits++
+		c.order.MoveToFront(elem)
+		return elem.Value.(*cacheEntry).result, nil, true
+	}
+
+	if leader, ok := c.inflight[key]; ok {
+		c.inflightHits++
+		return 0, leader, true
+	}
+
+	c.misses++
+	c.inflight[key] = task
+	return 0, nil, false
+}
+
+// release - saves result of leader task and evicts least recently used results
+func (c *resultCache) release(key string, result float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.inflight, key)
+
+	if c.capacity <= 0 {
+		return
+	}
+
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*cacheEntry).result = result
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&cacheEntry{key: key, result: result})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// abandon - forgets failed leader task, so next identical task is sent to agent again.
+// Does nothing if another task already became the leader
+func (c *resultCache) abandon(key string, leader *Task) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inflight[key] == leader {
+		delete(c.inflight, key)
+	}
+}
+
+// stats - returns counters of cache
+func (c *resultCache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := CacheStats{
+		Size:         c.order.Len(),
+		Capacity:     c.capacity,
+		Hits:         c.hits,
+		InflightHits: c.inflightHits,
+		Misses:       c.misses,
+	}
+	if total := c.hits + c.inflightHits + c.misses; total > 0 {
+		stats.HitRate = float64(c.hits+c.inflightHits) / float64(total)
+	}
+	return stats
+}
+
+// setCapacity - changes size of cache, evicting results if needed
+func (c *resultCache) setCapacity(capacity int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.capacity = capacity
+	for c.order.Len() > 0 && c.order.Len() > capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// dedupeSubtrees - makes identical subtrees share one node, so they are evaluated once. Returns amount of shared subtrees
+func dedupeSubtrees(root *Node) int {
+	seen := make(map[string]*Node)
+	removed := 0
+
+	var walk func(node *Node) (*Node, string)
+	walk = func(node *Node) (*Node, string) {
+		if node.Operation == "" {
+			return node, strconv.FormatFloat(node.Value, 'g', -1, 64)
+		}
+
+		left, leftKey := walk(node.Left)
+		right, rightKey := walk(node.Right)
+		node.Left, node.Right = left, right
+
+		key := "(" + leftKey + node.Operation + rightKey + ")"
+		if existing, ok := seen[key]; ok {
+			removed++
+			return existing, key
+		}
+		seen[key] = node
+		return node, key
+	}
+
+	walk(root)
+	return removed
+}
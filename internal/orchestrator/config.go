@@ -0,0 +1,314 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg"
+)
+
+// Config - settings which can be changed at runtime through admin API
+type Config struct {
+	OperationTimes   map[string]int `json:"operation_times"`
+	QueueMaxBacklog  int            `json:"queue_max_backlog"`
+	QueueRetryAfterS int            `json:"queue_retry_after_s"`
+	LeaseTimeoutMs   int            `json:"lease_timeout_ms"`
+	MaxRetries       int            `json:"max_retries"`
+}
+
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	Actor  string    `json:"actor"`
+	Before Config    `json:"before"`
+	After  Config    `json:"after"`
+}
+
+const maxOperationTimeMs = 60 * 60 * 1000
+
+// maxAuditEntries - how many last config changes are kept in audit log
+const maxAuditEntries = 1000
+
+// auditLog - ring buffer of the last maxAuditEntries config changes. Must be used with configMu held
+type auditLog struct {
+	entries []AuditEntry
+	// next - place of the oldest entry, which is overwritten next when buffer is full
+	next int
+}
+
+// add - appends entry, replacing the oldest one when buffer is full
+func (l *auditLog) add(entry AuditEntry) {
+	if len(l.entries) < maxAuditEntries {
+		l.entries = append(l.entries, entry)
+		return
+	}
+	l.entries[l.next] = entry
+	l.next = (l.next + 1) % maxAuditEntries
+}
+
+// list - copy of entries from the oldest to the newest
+func (l *auditLog) list() []AuditEntry {
+	entries := make([]AuditEntry, 0, len(l.entries))
+	entries = append(entries, l.entries[l.next:]...)
+	return append(entries, l.entries[:l.next]...)
+}
+
+// defaultConfig - config used when nothing is set in env
+func defaultConfig() Config {
+	return Config{
+		OperationTimes: map[string]int{
+			"+": 1000,
+			"-": 1000,
+			"*": 2000,
+			"/": 3000,
+		},
+		QueueMaxBacklog:  10000,
+		QueueRetryAfterS: 5,
+		LeaseTimeoutMs:   10000,
+		MaxRetries:       3,
+	}
+}
+
+// configFromEnv - builds config from env
+func configFromEnv() Config {
+	return Config{
+		OperationTimes: map[string]int{
+			"+": pkg.GetEnvIntWithDefault("TIME_ADDITION_MS", 1000),
+			"-": pkg.GetEnvIntWithDefault("TIME_SUBTRACTION_MS", 1000),
+			"*": pkg.GetEnvIntWithDefault("TIME_MULTIPLICATION_MS", 2000),
+			"/": pkg.GetEnvIntWithDefault("TIME_DIVISION_MS", 3000),
+		},
+		QueueMaxBacklog:  pkg.GetEnvIntWithDefault("QUEUE_MAX_BACKLOG", 10000),
+		QueueRetryAfterS: pkg.GetEnvIntWithDefault("QUEUE_RETRY_AFTER_S", 5),
+		LeaseTimeoutMs:   pkg.GetEnvIntWithDefault("LEASE_TIMEOUT_MS", 10000),
+		MaxRetries:       pkg.GetEnvIntWithDefault("MAX_RETRIES", 3),
+	}
+}
+
+// clone - deep copy of config
+func (c Config) clone() Config {
+	times := make(map[string]int, len(c.OperationTimes))
+	for op, ms := range c.OperationTimes {
+		times[op] = ms
+	}
+	c.OperationTimes = times
+	return c
+}
+
+// validate - checks that all values of config are allowed
+func (c Config) validate() error {
+	for _, op := range []string{"+", "-", "*", "/"} {
+		ms, ok := c.OperationTimes[op]
+		if !ok {
+			return fmt.Errorf("operation time for %q is missing", op)
+		}
+		if ms < 0 || ms > maxOperationTimeMs {
+			return fmt.Errorf("operation time for %q must be between 0 and %v ms", op, maxOperationTimeMs)
+		}
+	}
+	if len(c.OperationTimes) != 4 {
+		return errors.New("unknown operation in operation_times")
+	}
+	if c.QueueMaxBacklog < 0 {
+		return errors.New("queue_max_backlog must not be negative")
+	}
+	if c.QueueRetryAfterS < 1 {
+		return errors.New("queue_retry_after_s must be positive")
+	}
+	if c.LeaseTimeoutMs < 1 {
+		return errors.New("lease_timeout_ms must be positive")
+	}
+	if c.MaxRetries < 0 {
+		return errors.New("max_retries must not be negative")
+	}
+	return nil
+}
+
+// Config - returns copy of current config
+func (o *Orchestrator) Config() Config {
+	return o.getConfig()
+}
+
+// SetConfig - validates and applies config
+func (o *Orchestrator) SetConfig(cfg Config) error {
+	return o.setConfig(cfg, "api")
+}
+
+// getConfig - returns copy of current config
+func (o *Orchestrator) getConfig() Config {
+	o.configMu.RLock()
+	defer o.configMu.RUnlock()
+	return o.config.clone()
+}
+
+// getConfigFile - path of config file, empty if config is not saved
+func (o *Orchestrator) getConfigFile() string {
+	o.configMu.RLock()
+	defer o.configMu.RUnlock()
+	return o.configFile
+}
+
+// operationTime - time of operation from current config
+func (o *Orchestrator) operationTime(operation string) int {
+	o.configMu.RLock()
+	defer o.configMu.RUnlock()
+	return o.config.OperationTimes[operation]
+}
+
+// actorReload - actor of config changes made by reload of .env
+const actorReload = "reload"
+
+// setConfig - validates and applies config. Change is written to audit log, changes of admin API also to config file
+// if it is set
+func (o *Orchestrator) setConfig(cfg Config, actor string) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	o.configMu.Lock()
+	before := o.config
+	// reload happens on every change of .env, most of them don't touch config
+	if actor == actorReload && reflect.DeepEqual(before, cfg) {
+		o.configMu.Unlock()
+		return nil
+	}
+	o.config = cfg.clone()
+	o.auditLog.add(AuditEntry{Time: o.clock.Now(), Actor: actor, Before: before, After: o.config.clone()})
+	path := o.configFile
+	o.configMu.Unlock()
+
+	o.queue.setLimit(cfg.QueueMaxBacklog)
+	slog.Info("Config changed", "actor", actor, "before", before, "after", cfg)
+
+	// only changes of admin API are saved, otherwise file would shadow the next changes of .env
+	if path != "" && actor != actorReload {
+		if err := saveConfigFile(path, cfg); err != nil {
+			return fmt.Errorf("config applied, but not saved: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// readConfig - reads config from env and overrides it with config file if it exists. File keeps changes made
+// through admin API, so they must survive restart and reload of .env. To return to env, file must be removed
+func readConfig(path string) (Config, error) {
+	cfg := configFromEnv()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return cfg, err
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &cfg); err != nil {
+				return cfg, fmt.Errorf("parsing %v: %w", path, err)
+			}
+		}
+	}
+
+	return cfg, cfg.validate()
+}
+
+// loadConfig - loads config at start
+func (o *Orchestrator) loadConfig(path string) error {
+	o.configMu.Lock()
+	o.configFile = path
+	o.configMu.Unlock()
+
+	cfg, err := readConfig(path)
+	if err != nil {
+		return err
+	}
+	o.overrides.apply(&cfg)
+
+	o.configMu.Lock()
+	o.config = cfg
+	o.configMu.Unlock()
+
+	o.queue.setLimit(cfg.QueueMaxBacklog)
+
+	return nil
+}
+
+// reloadConfig - applies config from env and config file again, e.g. after .env has changed
+func (o *Orchestrator) reloadConfig() error {
+	cfg, err := readConfig(o.getConfigFile())
+	if err != nil {
+		return err
+	}
+	o.overrides.apply(&cfg)
+	return o.setConfig(cfg, actorReload)
+}
+
+// saveConfigFile - writes config to file atomically
+func saveConfigFile(path string, cfg Config) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// getConfigHandler - returns current runtime config
+func (o *Orchestrator) getConfigHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"config": o.getConfig()}); err != nil {
+		http.Error(w, "Error encoding config", http.StatusInternalServerError)
+		return
+	}
+}
+
+// putConfigHandler - changes runtime config. Fields which are not in request keep their values
+func (o *Orchestrator) putConfigHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := o.getConfig()
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		http.Error(w, "Invalid request body", http.StatusUnprocessableEntity)
+		return
+	}
+
+	actor := "unknown"
+	if principal := principalFromContext(r.Context()); principal != nil {
+		actor = principal.OwnerID
+		if principal.KeyID != "" {
+			actor = "key:" + principal.KeyID
+		}
+	}
+
+	if err := cfg.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err := o.setConfig(cfg, actor); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	o.getConfigHandler(w, r)
+}
+
+// getAuditHandler - returns the last maxAuditEntries config changes
+func (o *Orchestrator) getAuditHandler(w http.ResponseWriter, r *http.Request) {
+	o.configMu.RLock()
+	entries := o.auditLog.list()
+	o.configMu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"audit": entries}); err != nil {
+		http.Error(w, "Error encoding audit log", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,83 @@
+package orchestrator
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg"
+)
+
+func TestReloadEnvFile(t *testing.T) {
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, ".env")
+	configFile := filepath.Join(dir, "config.json")
+	t.Cleanup(func() { os.Unsetenv("TIME_ADDITION_MS") })
+
+	reload := func(o *Orchestrator, ms string) {
+		t.Helper()
+		if err := os.WriteFile(envFile, []byte("TIME_ADDITION_MS = "+ms+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := pkg.LoadEnvFile(envFile); err != nil {
+			t.Fatal(err)
+		}
+		if err := o.reloadConfig(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	o := NewOrchestrator()
+	if err := os.WriteFile(envFile, []byte("TIME_ADDITION_MS = 500\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := pkg.LoadEnvFile(envFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.loadConfig(configFile); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ms := range []string{"700", "900", "900"} {
+		reload(o, ms)
+		if got := o.operationTime("+"); strconv.Itoa(got) != ms {
+			t.Fatalf("expected %vms after reload, got %v", ms, got)
+		}
+	}
+
+	// variable removed from file returns to default
+	if err := os.WriteFile(envFile, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := pkg.LoadEnvFile(envFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.reloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if got := o.operationTime("+"); got != 1000 {
+		t.Fatalf("expected default 1000ms after variable is removed, got %v", got)
+	}
+
+	if _, err := os.Stat(configFile); !os.IsNotExist(err) {
+		t.Errorf("expected reload not to write config file, got %v", err)
+	}
+	if entries := o.auditLog.list(); len(entries) != 3 {
+		t.Errorf("expected 3 audit entries for 3 changes, got %v", len(entries))
+	}
+
+	// change of admin API is saved and wins over .env after restart
+	cfg := o.Config()
+	cfg.OperationTimes["+"] = 100
+	if err := o.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	restarted := NewOrchestrator()
+	if err := restarted.loadConfig(configFile); err != nil {
+		t.Fatal(err)
+	}
+	if got := restarted.operationTime("+"); got != 100 {
+		t.Errorf("expected 100ms from config file, got %v", got)
+	}
+}
@@ -0,0 +1,116 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/calc"
+)
+
+type ExplainNode struct {
+	Value     *float64     `json:"value,omitempty"`
+	Operation string       `json:"operation,omitempty"`
+	Left      *ExplainNode `json:"left,omitempty"`
+	Right     *ExplainNode `json:"right,omitempty"`
+}
+
+type Explain struct {
+	Expression    string         `json:"expression"`
+	Postfix       []string       `json:"postfix"`
+	Tree          *ExplainNode   `json:"tree"`
+	Optimizations []Optimization `json:"optimizations"`
+	Operations    int            `json:"operations"`
+	Depth         int            `json:"depth"`
+}
+
+// parseExpression - builds AST from expression string. Every stage is traced as child of span in ctx
+func (o *Orchestrator) parseExpression(ctx context.Context, expression string) ([]string, *Node, error) {
+	_, span := o.tracer.Start(ctx, "tokenize")
+	tokens, err := calc.Tokenize(expression)
+	span.SetError(err)
+	span.End()
+	if err != nil {
+		return nil, nil, fmt.Errorf("tokenizing expression: %w", err)
+	}
+
+	_, span = o.tracer.Start(ctx, "parse")
+	postfix, err := calc.InfixToPostfix(tokens)
+	span.SetError(err)
+	span.End()
+	if err != nil {
+		return nil, nil, fmt.Errorf("converting to postfix: %w", err)
+	}
+
+	_, span = o.tracer.Start(ctx, "build_tree")
+	root, err := buildExpressionTree(postfix)
+	span.SetError(err)
+	span.End()
+	if err != nil {
+		return nil, nil, fmt.Errorf("building expression tree: %w", err)
+	}
+
+	return postfix, root, nil
+}
+
+// explainHandler - shows AST of expression and changes made by optimizer without calculating it
+func (o *Orchestrator) explainHandler(w http.ResponseWriter, r *http.Request) {
+	var req ExpressionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusUnprocessableEntity)
+		return
+	}
+
+	postfix, root, err := o.parseExpression(r.Context(), req.Expression)
+	if err != nil {
+		http.Error(w, "Invalid expression", http.StatusUnprocessableEntity)
+		return
+	}
+
+	explain := &Explain{
+		Expression:    req.Expression,
+		Postfix:       postfix,
+		Optimizations: []Optimization{},
+	}
+
+	if req.Optimize {
+		root, explain.Optimizations = optimizeTree(root)
+		if explain.Optimizations == nil {
+			explain.Optimizations = []Optimization{}
+		}
+	}
+
+	explain.Tree = explainTree(root)
+	explain.Operations = countOperations(root)
+	explain.Depth = depth(root)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"explain": explain}); err != nil {
+		http.Error(w, "Error encoding explain", http.StatusInternalServerError)
+		return
+	}
+}
+
+// explainTree - converts AST to JSON friendly form
+func explainTree(node *Node) *ExplainNode {
+	if node.Operation == "" {
+		value := node.Value
+		return &ExplainNode{Value: &value}
+	}
+	return &ExplainNode{
+		Operation: node.Operation,
+		Left:      explainTree(node.Left),
+		Right:     explainTree(node.Right),
+	}
+}
+
+// countOperations - amount of tasks which will be created for tree
+func countOperations(node *Node) int {
+	if node.Operation == "" {
+		return 0
+	}
+	return 1 + countOperations(node.Left) + countOperations(node.Right)
+}
@@ -0,0 +1,233 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg"
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/clock"
+)
+
+// AgentInfo - last known state of agent
+type AgentInfo struct {
+	ID       string    `json:"id"`
+	Addr     string    `json:"addr"`
+	LastSeen time.Time `json:"last_seen"`
+	Workers  int       `json:"workers"`
+	Busy     int       `json:"busy"`
+	Active   bool      `json:"active"`
+}
+
+// Heartbeat - state which agent sends periodically
+type Heartbeat struct {
+	ID      string `json:"id"`
+	Workers int    `json:"workers"`
+	Busy    int    `json:"busy"`
+}
+
+// agentRegistry - agents which requested tasks or sent heartbeat
+type agentRegistry struct {
+	mu      sync.Mutex
+	agents  map[string]*AgentInfo
+	timeout time.Duration
+	clock   clock.Clock
+}
+
+func newAgentRegistry(timeout time.Duration, c clock.Clock) *agentRegistry {
+	return &agentRegistry{agents: make(map[string]*AgentInfo), timeout: timeout, clock: c}
+}
+
+// loadHealthEnv - loads how long agent is considered active after last request
+func (o *Orchestrator) loadHealthEnv() {
+	o.agents.mu.Lock()
+	defer o.agents.mu.Unlock()
+	o.agents.timeout = time.Duration(pkg.GetEnvIntWithDefault("AGENT_HEARTBEAT_TIMEOUT_MS", 15000)) * time.Millisecond
+}
+
+// seen - records request of agent. Requests without agent ID are ignored
+func (a *agentRegistry) seen(id, addr string) {
+	if id == "" {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	info, ok := a.agents[id]
+	if !ok {
+		info = &AgentInfo{ID: id}
+		a.agents[id] = info
+	}
+	info.Addr = addr
+	info.LastSeen = a.clock.Now()
+}
+
+// heartbeat - records state reported by agent
+func (a *agentRegistry) heartbeat(hb Heartbeat, addr string) {
+	a.seen(hb.ID, addr)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if info, ok := a.agents[hb.ID]; ok {
+		info.Workers = hb.Workers
+		info.Busy = hb.Busy
+	}
+}
+
+// list - all known agents, active first. Agents silent for ten timeouts are forgotten
+func (a *agentRegistry) list() []AgentInfo {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.clock.Now()
+	list := make([]AgentInfo, 0, len(a.agents))
+	for id, info := range a.agents {
+		silent := now.Sub(info.LastSeen)
+		if silent > 10*a.timeout {
+			delete(a.agents, id)
+			continue
+		}
+		agent := *info
+		agent.Active = silent <= a.timeout
+		list = append(list, agent)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Active != list[j].Active {
+			return list[i].Active
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// active - amount of agents seen within timeout
+func (a *agentRegistry) active() int {
+	count := 0
+	for _, agent := range a.list() {
+		if agent.Active {
+			count++
+		}
+	}
+	return count
+}
+
+// heartbeatHandler - internal function for agent. Records its pool size and busy workers
+func (o *Orchestrator) heartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	var hb Heartbeat
+	if err := json.NewDecoder(r.Body).Decode(&hb); err != nil || hb.ID == "" {
+		http.Error(w, "Invalid request", http.StatusUnprocessableEntity)
+		return
+	}
+
+	o.RecordHeartbeat(hb, r.RemoteAddr)
+	w.WriteHeader(http.StatusOK)
+}
+
+// RecordHeartbeat - records state of agent, addr is shown in list of agents
+func (o *Orchestrator) RecordHeartbeat(hb Heartbeat, addr string) {
+	o.agents.heartbeat(hb, addr)
+}
+
+// healthzHandler - liveness probe. Orchestrator is alive while it answers
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// readyzHandler - readiness probe. Ready when not shutting down, files for config and state are writable
+// and at least one agent was seen recently
+func (o *Orchestrator) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{}
+	ready := true
+
+	if o.draining.Load() {
+		checks["shutdown"] = "in progress"
+		ready = false
+	} else {
+		checks["shutdown"] = "ok"
+	}
+
+	if err := checkStorage(o.getConfigFile(), o.stateFile); err != nil {
+		checks["storage"] = err.Error()
+		ready = false
+	} else {
+		checks["storage"] = "ok"
+	}
+
+	if active := o.agents.active(); active == 0 {
+		checks["agents"] = "no active agents"
+		ready = false
+	} else {
+		checks["agents"] = fmt.Sprintf("%d active", active)
+	}
+
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not ready", http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": status, "checks": checks})
+}
+
+// checkStorage - checks that directories of configured files are writable
+func checkStorage(paths ...string) error {
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		f, err := os.CreateTemp(filepath.Dir(path), ".readyz-*")
+		if err != nil {
+			return fmt.Errorf("%v is not writable: %w", path, err)
+		}
+		f.Close()
+		os.Remove(f.Name())
+	}
+	return nil
+}
+
+// DebugState - internal state of orchestrator for diagnostics
+type DebugState struct {
+	Expressions map[string]int `json:"expressions"`
+	Queue       QueueStats     `json:"queue"`
+	QueuedTasks []QueuedTask   `json:"queued_tasks"`
+	Leases      []LeaseInfo    `json:"leases"`
+	Agents      []AgentInfo    `json:"agents"`
+	Cache       CacheStats     `json:"cache"`
+	Config      Config         `json:"config"`
+}
+
+// debugStateHandler - admin function. Dumps queue contents, leases, agents and expression counts by status
+func (o *Orchestrator) debugStateHandler(w http.ResponseWriter, r *http.Request) {
+	counts := map[string]int{}
+
+	for _, expr := range o.store.List() {
+		expr.mu.Lock()
+		counts[expr.Status]++
+		expr.mu.Unlock()
+	}
+
+	state := DebugState{
+		Expressions: counts,
+		Queue:       o.queue.stats(),
+		QueuedTasks: o.queue.snapshot(),
+		Leases:      o.leases.snapshot(),
+		Agents:      o.agents.list(),
+		Cache:       o.cache.stats(),
+		Config:      o.getConfig(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(state); err != nil {
+		http.Error(w, "Error encoding state", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,134 @@
+package orchestrator
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/logging"
+	"github.com/gorilla/mux"
+)
+
+// agentIDHeader - header with ID of agent, used in logs
+const agentIDHeader = "X-Agent-ID"
+
+// internalConfig - settings of API used by agents
+type internalConfig struct {
+	addr       string
+	token      string
+	certFile   string
+	keyFile    string
+	clientCA   string
+	clientPool *x509.CertPool
+}
+
+// loadInternalEnv - loads address and credentials of internal API from env
+func (o *Orchestrator) loadInternalEnv(addr, token, certFile, keyFile, clientCA string) error {
+	o.internalCfg = internalConfig{
+		addr:     addr,
+		token:    token,
+		certFile: certFile,
+		keyFile:  keyFile,
+		clientCA: clientCA,
+	}
+
+	// on public port the token is the only thing which keeps users away from tasks
+	if addr == "" && token == "" {
+		return errors.New("AGENT_TOKEN is required when INTERNAL_ADDR is empty")
+	}
+
+	if clientCA == "" {
+		return nil
+	}
+	if addr == "" || certFile == "" || keyFile == "" {
+		return errors.New("mTLS requires INTERNAL_ADDR, INTERNAL_TLS_CERT and INTERNAL_TLS_KEY")
+	}
+
+	pem, err := os.ReadFile(clientCA)
+	if err != nil {
+		return err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return errors.New("no certificates in INTERNAL_CLIENT_CA")
+	}
+	o.internalCfg.clientPool = pool
+
+	return nil
+}
+
+// registerInternalHandlers - registers handlers used by agents
+func (o *Orchestrator) registerInternalHandlers(r *mux.Router) {
+	internal := r.PathPrefix("/internal").Subrouter()
+	internal.Use(o.agentAuthMiddleware, o.agentSeenMiddleware)
+	internal.HandleFunc("/task", o.sendTaskHandler).Methods("GET")
+	internal.HandleFunc("/task", o.getTaskHandler).Methods("POST")
+	internal.HandleFunc("/task/release", o.releaseTaskHandler).Methods("POST")
+	internal.HandleFunc("/heartbeat", o.heartbeatHandler).Methods("POST")
+}
+
+// agentSeenMiddleware - every request of agent counts as heartbeat
+func (o *Orchestrator) agentSeenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		o.agents.seen(r.Header.Get(agentIDHeader), r.RemoteAddr)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// agentAuthMiddleware - allows only agents with shared token or verified client certificate
+func (o *Orchestrator) agentAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if o.internalCfg.clientPool != nil {
+			if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+				http.Error(w, "Client certificate required", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		if o.internalCfg.token != "" {
+			token := bearerToken(r)
+			if subtle.ConstantTimeCompare([]byte(token), []byte(o.internalCfg.token)) != 1 {
+				http.Error(w, "Invalid agent token", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// newInternalServer - creates server for internal API on its own address. Uses mTLS if client CA is set
+func (o *Orchestrator) newInternalServer() *http.Server {
+	r := mux.NewRouter()
+	r.Use(logging.Middleware, o.metricsMiddleware)
+	o.registerInternalHandlers(r)
+
+	server := &http.Server{
+		Addr:    o.internalCfg.addr,
+		Handler: r,
+	}
+
+	if o.internalCfg.clientPool != nil {
+		server.TLSConfig = &tls.Config{
+			ClientCAs:  o.internalCfg.clientPool,
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+
+	return server
+}
+
+// serveInternal - starts internal server, with TLS if certificate is set. Blocks until server is closed
+func (o *Orchestrator) serveInternal(server *http.Server) error {
+	if o.internalCfg.certFile != "" && o.internalCfg.keyFile != "" {
+		slog.Info("Starting internal server", "addr", o.internalCfg.addr, "tls", true)
+		return server.ListenAndServeTLS(o.internalCfg.certFile, o.internalCfg.keyFile)
+	}
+	slog.Info("Starting internal server", "addr", o.internalCfg.addr, "tls", false)
+	return server.ListenAndServe()
+}
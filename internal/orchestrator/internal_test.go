@@ -0,0 +1,137 @@
+package orchestrator
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// writeCA - writes self-signed CA certificate in PEM to temp dir
+func writeCA(t *testing.T) string {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "agents"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadInternalEnv(t *testing.T) {
+	ca := writeCA(t)
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(empty, []byte("no certificates"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		addr     string
+		token    string
+		cert     string
+		key      string
+		clientCA string
+		err      bool
+	}{
+		{name: "Public port with token", token: "secret"},
+		{name: "Public port without token", err: true},
+		{name: "Own address without token", addr: ":9090"},
+		{name: "mTLS", addr: ":9090", cert: "cert.pem", key: "key.pem", clientCA: ca},
+		{name: "mTLS on public port", token: "secret", cert: "cert.pem", key: "key.pem", clientCA: ca, err: true},
+		{name: "mTLS without server certificate", addr: ":9090", clientCA: ca, err: true},
+		{name: "Missing CA file", addr: ":9090", cert: "cert.pem", key: "key.pem", clientCA: filepath.Join(t.TempDir(), "missing.pem"), err: true},
+		{name: "CA file without certificates", addr: ":9090", cert: "cert.pem", key: "key.pem", clientCA: empty, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := NewOrchestrator()
+			err := o.loadInternalEnv(tt.addr, tt.token, tt.cert, tt.key, tt.clientCA)
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if err == nil && (tt.clientCA != "") != (o.internalCfg.clientPool != nil) {
+				t.Errorf("expected client CA pool only with INTERNAL_CLIENT_CA")
+			}
+		})
+	}
+}
+
+func TestAgentAuth(t *testing.T) {
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+
+	tests := []struct {
+		name     string
+		token    string
+		mtls     bool
+		header   string
+		tls      *tls.ConnectionState
+		expected int
+	}{
+		{name: "Valid token", token: "secret", header: "Bearer secret", expected: http.StatusNotFound},
+		{name: "Without token", token: "secret", expected: http.StatusUnauthorized},
+		{name: "Wrong token", token: "secret", header: "Bearer other", expected: http.StatusUnauthorized},
+		{name: "Token prefix", token: "secret", header: "Bearer secre", expected: http.StatusUnauthorized},
+		{name: "Token without scheme", token: "secret", header: "secret", expected: http.StatusUnauthorized},
+		{name: "Verified certificate", mtls: true, tls: verified, expected: http.StatusNotFound},
+		{name: "Without TLS", mtls: true, expected: http.StatusUnauthorized},
+		{name: "Unverified certificate", mtls: true, tls: &tls.ConnectionState{}, expected: http.StatusUnauthorized},
+		{name: "Certificate and token", token: "secret", mtls: true, tls: verified, header: "Bearer secret", expected: http.StatusNotFound},
+		{name: "Certificate without token", token: "secret", mtls: true, tls: verified, expected: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := NewOrchestrator()
+			o.internalCfg.token = tt.token
+			if tt.mtls {
+				o.internalCfg.clientPool = x509.NewCertPool()
+			}
+			r := mux.NewRouter()
+			o.registerInternalHandlers(r)
+
+			req := httptest.NewRequest(http.MethodGet, "/internal/task", nil)
+			req.TLS = tt.tls
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			// 404 means agent passed and there are no tasks
+			if rec.Code != tt.expected {
+				t.Errorf("expected %v, got %v: %v", tt.expected, rec.Code, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package orchestrator
+
+import (
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/clock"
+)
+
+var ErrTaskExpired = errors.New("task lease expired too many times")
+
+// lease - task given to agent. If agent doesn't send result before deadline, task is returned to queue
+type lease struct {
+	task     *Task
+	agentID  string
+	deadline time.Time
+	timer    clock.Timer
+}
+
+// LeaseInfo - lease in debug view
+type LeaseInfo struct {
+	TaskID       string    `json:"task_id"`
+	ExpressionID string    `json:"expression_id"`
+	Operation    string    `json:"operation"`
+	AgentID      string    `json:"agent_id,omitempty"`
+	Deadline     time.Time `json:"deadline"`
+	Attempts     int       `json:"attempts"`
+}
+
+// leaseTable - tasks which are being calculated by agents. Expired tasks are returned to queue
+type leaseTable struct {
+	mu          sync.Mutex
+	leases      map[string]*lease
+	expirations uint64
+	queue       *taskQueue
+	clock       clock.Clock
+	config      func() Config
+}
+
+func newLeaseTable(queue *taskQueue, c clock.Clock, config func() Config) *leaseTable {
+	return &leaseTable{
+		leases: make(map[string]*lease),
+		queue:  queue,
+		clock:  c,
+		config: config,
+	}
+}
+
+// grant - gives task to agent for operation time plus lease timeout
+func (l *leaseTable) grant(task *Task, agentID string) {
+	d := time.Duration(task.OperationTime+l.config().LeaseTimeoutMs) * time.Millisecond
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.leases[task.ID] = &lease{
+		task:     task,
+		agentID:  agentID,
+		deadline: l.clock.Now().Add(d),
+		timer:    l.clock.AfterFunc(d, func() { l.expire(task) }),
+	}
+}
+
+// release - removes lease of task when its result is received
+func (l *leaseTable) release(taskID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if ls, ok := l.leases[taskID]; ok {
+		ls.timer.Stop()
+		delete(l.leases, taskID)
+	}
+}
+
+// expire - returns task to queue or fails it if there are no retries left
+func (l *leaseTable) expire(task *Task) {
+	l.mu.Lock()
+	if _, ok := l.leases[task.ID]; !ok {
+		l.mu.Unlock()
+		return
+	}
+	delete(l.leases, task.ID)
+	l.expirations++
+	l.mu.Unlock()
+
+	// result or cancel could come after lease was removed, so task is checked under expression mutex
+	expr := task.expr
+	expr.mu.Lock()
+	if task.finished() {
+		expr.mu.Unlock()
+		return
+	}
+	task.attempts++
+	attempts := task.attempts
+	if attempts > l.config().MaxRetries {
+		task.fail(ErrTaskExpired)
+		expr.mu.Unlock()
+		slog.Warn("Task failed after retries", "task_id", task.ID, "expression_id", expr.ID, "attempts", attempts)
+		return
+	}
+	task.Status = "queued"
+	l.queue.push(task)
+	expr.mu.Unlock()
+
+	slog.Warn("Lease expired, returning task to queue", "task_id", task.ID, "expression_id", task.ExpressionID, "attempt", attempts)
+}
+
+// stopAll - stops timers of all leases at shutdown
+func (l *leaseTable) stopAll() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for id, ls := range l.leases {
+		ls.timer.Stop()
+		delete(l.leases, id)
+	}
+}
+
+// handBack - agent returns task which it can't finish, so it goes back to queue without waiting for lease to expire
+func (l *leaseTable) handBack(task *Task) {
+	l.mu.Lock()
+	ls, ok := l.leases[task.ID]
+	if ok {
+		ls.timer.Stop()
+		delete(l.leases, task.ID)
+	}
+	l.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	task.expr.mu.Lock()
+	if task.finished() {
+		task.expr.mu.Unlock()
+		return
+	}
+	task.Status = "queued"
+	l.queue.push(task)
+	task.expr.mu.Unlock()
+
+	slog.Info("Task handed back by agent, returning to queue", "task_id", task.ID, "expression_id", task.ExpressionID)
+}
+
+// count - amount of active leases and expired leases since start
+func (l *leaseTable) count() (int, uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.leases), l.expirations
+}
+
+// snapshot - active leases ordered by deadline
+func (l *leaseTable) snapshot() []LeaseInfo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	list := make([]LeaseInfo, 0, len(l.leases))
+	for _, ls := range l.leases {
+		list = append(list, LeaseInfo{
+			TaskID:       ls.task.ID,
+			ExpressionID: ls.task.ExpressionID,
+			Operation:    ls.task.Operation,
+			AgentID:      ls.agentID,
+			Deadline:     ls.deadline,
+			Attempts:     ls.task.attempts,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Deadline.Before(list[j].Deadline) })
+	return list
+}
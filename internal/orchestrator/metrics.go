@@ -0,0 +1,80 @@
+package orchestrator
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/logging"
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/metrics"
+	"github.com/gorilla/mux"
+)
+
+// orchestratorMetrics - metrics of orchestrator served on /metrics
+type orchestratorMetrics struct {
+	registry *metrics.Registry
+
+	expressionsSubmitted *metrics.Counter
+	expressionsFinished  *metrics.Counter
+	queueDepth           *metrics.Gauge
+	taskQueueWait        *metrics.Histogram
+	taskDuration         *metrics.Histogram
+	httpDuration         *metrics.Histogram
+}
+
+// newMetrics - registers metrics of orchestrator
+func newMetrics(o *Orchestrator) *orchestratorMetrics {
+	r := metrics.NewRegistry()
+	m := &orchestratorMetrics{
+		registry:             r,
+		expressionsSubmitted: r.Counter("calc_expressions_submitted_total", "Expressions accepted for calculation.", "priority"),
+		expressionsFinished:  r.Counter("calc_expressions_finished_total", "Expressions which reached final status.", "status"),
+		queueDepth:           r.Gauge("calc_queue_depth", "Tasks waiting for agent.", "priority"),
+		taskQueueWait:        r.Histogram("calc_task_queue_wait_seconds", "Time from task enqueue to agent lease.", nil, "operation"),
+		taskDuration:         r.Histogram("calc_task_duration_seconds", "Time from task creation to result from agent.", nil, "operation"),
+		httpDuration:         r.Histogram("calc_http_request_duration_seconds", "Duration of HTTP requests.", nil, "method", "route", "code"),
+	}
+
+	r.OnCollect(func() {
+		for priority, depth := range o.queue.depths() {
+			m.queueDepth.Set(float64(depth), priority)
+		}
+	})
+	r.CounterFunc("calc_queue_rejected_total", "Expressions rejected by admission control.", func() float64 {
+		return float64(o.queue.stats().Rejected)
+	})
+	r.GaugeFunc("calc_leases_active", "Tasks currently leased by agents.", func() float64 {
+		active, _ := o.leases.count()
+		return float64(active)
+	})
+	r.CounterFunc("calc_lease_expirations_total", "Leases expired without result from agent.", func() float64 {
+		_, expired := o.leases.count()
+		return float64(expired)
+	})
+	r.CounterFunc("calc_cache_hits_total", "Task results taken from cache or from identical task in flight.", func() float64 {
+		stats := o.cache.stats()
+		return float64(stats.Hits + stats.InflightHits)
+	})
+	r.CounterFunc("calc_cache_misses_total", "Tasks sent to agents because result was not cached.", func() float64 {
+		return float64(o.cache.stats().Misses)
+	})
+
+	return m
+}
+
+// metricsMiddleware - measures duration of requests by route template, so IDs in path don't create new series
+func (o *Orchestrator) metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := logging.NewStatusRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if tpl, err := current.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		o.metrics.httpDuration.Observe(time.Since(start).Seconds(), r.Method, route, strconv.Itoa(rec.Code))
+	})
+}
@@ -0,0 +1,165 @@
+package orchestrator
+
+import (
+	"strconv"
+)
+
+type Optimization struct {
+	Rule   string `json:"rule"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// optimizeTree - applies algebraic identities and balances associative chains. Returns new root and list of changes
+func optimizeTree(root *Node) (*Node, []Optimization) {
+	var changes []Optimization
+
+	root = simplify(root, &changes)
+	root = balance(root, &changes)
+
+	return root, changes
+}
+
+// simplify - removes operations which result is known without calculation (x*1, x+0, x*0, x-x and etc.).
+// x*0 and x-x are not applied if x has division, because division by zero in x must still fail
+func simplify(node *Node, changes *[]Optimization) *Node {
+	if node.Operation == "" {
+		return node
+	}
+
+	node.Left = simplify(node.Left, changes)
+	node.Right = simplify(node.Right, changes)
+
+	var result *Node
+	var rule string
+
+	switch node.Operation {
+	case "+":
+		if isConst(node.Right, 0) {
+			result, rule = node.Left, "x+0 = x"
+		} else if isConst(node.Left, 0) {
+			result, rule = node.Right, "0+x = x"
+		}
+	case "-":
+		if isConst(node.Right, 0) {
+			result, rule = node.Left, "x-0 = x"
+		} else if equalNodes(node.Left, node.Right) && !hasDivision(node.Left) {
+			result, rule = &Node{Value: 0}, "x-x = 0"
+		}
+	case "*":
+		if isConst(node.Right, 0) && !hasDivision(node.Left) || isConst(node.Left, 0) && !hasDivision(node.Right) {
+			result, rule = &Node{Value: 0}, "x*0 = 0"
+		} else if isConst(node.Right, 1) {
+			result, rule = node.Left, "x*1 = x"
+		} else if isConst(node.Left, 1) {
+			result, rule = node.Right, "1*x = x"
+		}
+	case "/":
+		if isConst(node.Right, 1) {
+			result, rule = node.Left, "x/1 = x"
+		}
+	}
+
+	if result == nil {
+		return node
+	}
+
+	*changes = append(*changes, Optimization{Rule: rule, Before: formatNode(node), After: formatNode(result)})
+	return result
+}
+
+// balance - turns chains of one associative operation into balanced trees, so more tasks can be calculated in parallel
+func balance(node *Node, changes *[]Optimization) *Node {
+	if node.Operation == "" {
+		return node
+	}
+
+	if node.Operation != "+" && node.Operation != "*" {
+		node.Left = balance(node.Left, changes)
+		node.Right = balance(node.Right, changes)
+		return node
+	}
+
+	var operands []*Node
+	collectChain(node, node.Operation, &operands)
+	for i := range operands {
+		operands[i] = balance(operands[i], changes)
+	}
+
+	balanced := buildBalanced(node.Operation, operands)
+	if depth(balanced) < depth(node) {
+		*changes = append(*changes, Optimization{
+			Rule:   "balance " + node.Operation + " chain of " + strconv.Itoa(len(operands)) + " operands",
+			Before: formatNode(node),
+			After:  formatNode(balanced),
+		})
+	}
+
+	return balanced
+}
+
+// collectChain - collects operands of subtree made of one operation, keeping their order
+func collectChain(node *Node, operation string, operands *[]*Node) {
+	if node.Operation != operation {
+		*operands = append(*operands, node)
+		return
+	}
+	collectChain(node.Left, operation, operands)
+	collectChain(node.Right, operation, operands)
+}
+
+// buildBalanced - builds tree of minimal depth from operands
+func buildBalanced(operation string, operands []*Node) *Node {
+	if len(operands) == 1 {
+		return operands[0]
+	}
+	mid := len(operands) / 2
+	return &Node{
+		Operation: operation,
+		Left:      buildBalanced(operation, operands[:mid]),
+		Right:     buildBalanced(operation, operands[mid:]),
+	}
+}
+
+// depth - amount of operation levels in tree
+func depth(node *Node) int {
+	if node.Operation == "" {
+		return 0
+	}
+	return 1 + max(depth(node.Left), depth(node.Right))
+}
+
+// isConst - checks if node is number equal to value
+func isConst(node *Node, value float64) bool {
+	return node.Operation == "" && node.Value == value
+}
+
+// equalNodes - checks if trees have the same structure and numbers. Stops at the first difference
+func equalNodes(a, b *Node) bool {
+	if a == b {
+		return true
+	}
+	if a.Operation != b.Operation {
+		return false
+	}
+	if a.Operation == "" {
+		return a.Value == b.Value
+	}
+	return equalNodes(a.Left, b.Left) && equalNodes(a.Right, b.Right)
+}
+
+// hasDivision - checks if tree has division, which can fail
+func hasDivision(node *Node) bool {
+	if node.Operation == "" {
+		return false
+	}
+	return node.Operation == "/" || hasDivision(node.Left) || hasDivision(node.Right)
+}
+
+// formatNode - returns infix form of tree with parentheses around every operation
+func formatNode(node *Node) string {
+	if node.Operation == "" {
+		return strconv.FormatFloat(node.Value, 'g', -1, 64)
+	}
+	return "(" + formatNode(node.Left) + node.Operation + formatNode(node.Right) + ")"
+}
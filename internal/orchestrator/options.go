@@ -0,0 +1,74 @@
+package orchestrator
+
+import (
+	"time"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/clock"
+	"github.com/google/uuid"
+)
+
+// Option - replaces dependency or default setting of orchestrator in NewOrchestrator
+type Option func(*options)
+
+type options struct {
+	queue          Queue
+	store          Store
+	clock          clock.Clock
+	newID          func() string
+	operationTimes map[string]time.Duration
+}
+
+func defaultOptions() options {
+	return options{
+		queue: NewScheduler(),
+		store: NewMemoryStore(),
+		clock: clock.Real(),
+		newID: func() string { return uuid.New().String() },
+	}
+}
+
+// WithQueue - replaces weighted fair scheduler of tasks
+func WithQueue(queue Queue) Option {
+	return func(o *options) {
+		o.queue = queue
+	}
+}
+
+// WithStore - replaces in-memory store of expressions
+func WithStore(store Store) Option {
+	return func(o *options) {
+		o.store = store
+	}
+}
+
+// WithClock - replaces real time, e.g. by clock.Fake in tests. Used for leases, queue wait, usage and tokens
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithIDGenerator - replaces random UUIDs of expressions, tasks, users and API keys
+func WithIDGenerator(newID func() string) Option {
+	return func(o *options) {
+		o.newID = newID
+	}
+}
+
+// WithOperationTimes - sets time of "+", "-", "*" and "/" instead of defaults. Other operations are ignored,
+// times are limited to 0..1h. They win over env and config file on start and reload, but can be changed by API
+func WithOperationTimes(times map[string]time.Duration) Option {
+	return func(o *options) {
+		o.operationTimes = times
+	}
+}
+
+// apply - sets operation times from options to config. Called after config is read from env, so options win
+func (o options) apply(cfg *Config) {
+	for op, d := range o.operationTimes {
+		if _, ok := cfg.OperationTimes[op]; !ok {
+			continue
+		}
+		cfg.OperationTimes[op] = int(min(max(d.Milliseconds(), 0), maxOperationTimeMs))
+	}
+}
@@ -1,301 +1,767 @@
 package orchestrator
 
 import (
+	"context"
+	"crypto/rand"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/AzizovHikmatullo/calc-go_V2/pkg"
 	"github.com/AzizovHikmatullo/calc-go_V2/pkg/calc"
-	"github.com/google/uuid"
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/clock"
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/logging"
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/trace"
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
-	"log"
+	"log/slog"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// Orchestrator - splits expressions into tasks and gives them to agents. All state belongs to orchestrator,
+// so several of them can work in one process
 type Orchestrator struct {
+	store Store
+	clock clock.Clock
+	newID func() string
+
+	cache   *resultCache
+	queue   *taskQueue
+	leases  *leaseTable
+	usage   *usageTracker
+	agents  *agentRegistry
+	limiter *rateLimiter
+	metrics *orchestratorMetrics
+	tracer  *trace.Tracer
+
+	rateLimits  rateLimitConfig
+	internalCfg internalConfig
+
+	configMu   sync.RWMutex
+	config     Config
+	configFile string
+	auditLog   auditLog
+	// overrides - settings from options, they win over env and config file
+	overrides options
+
+	users     map[string]*User
+	usersMu   sync.Mutex
+	jwtSecret []byte
+	tokenTTL  time.Duration
+
+	apiKeys   map[string]*APIKey
+	apiKeysMu sync.Mutex
+
+	evaluationMu  sync.RWMutex
+	evaluationCtx context.Context
+	draining      atomic.Bool
+	// finished - signalled when any expression gets final status, so shutdown doesn't poll
+	finished        chan struct{}
+	stateFile       string
+	shutdownTimeout time.Duration
 }
 
-// NewOrchestrator - return empty orchestrator
-func NewOrchestrator() *Orchestrator {
-	return &Orchestrator{}
+var (
+	ErrExpressionNotFound = errors.New("expression not found")
+	ErrTaskNotFound       = errors.New("task not found")
+	ErrInvalidPriority    = errors.New("invalid priority")
+	ErrShuttingDown       = errors.New("orchestrator is shutting down")
+	ErrQueueFull          = errors.New("task queue is full")
+)
+
+var maxWait = 60 * time.Second
+
+// NewOrchestrator - creates orchestrator with default config and random JWT secret. Settings from env are loaded by Run,
+// dependencies can be replaced by options
+func NewOrchestrator(opts ...Option) *Orchestrator {
+	options := defaultOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	o := &Orchestrator{
+		store:           options.store,
+		clock:           options.clock,
+		newID:           options.newID,
+		cache:           newResultCache(1000),
+		queue:           newTaskQueue(options.queue, options.clock),
+		usage:           newUsageTracker(),
+		agents:          newAgentRegistry(15*time.Second, options.clock),
+		limiter:         newRateLimiter(),
+		tracer:          trace.NewTracer("orchestrator", nil).WithClock(options.clock),
+		config:          defaultConfig(),
+		users:           make(map[string]*User),
+		jwtSecret:       make([]byte, 32),
+		tokenTTL:        24 * time.Hour,
+		apiKeys:         make(map[string]*APIKey),
+		evaluationCtx:   context.Background(),
+		finished:        make(chan struct{}, 1),
+		shutdownTimeout: 30 * time.Second,
+		overrides:       options,
+	}
+	options.apply(&o.config)
+	rand.Read(o.jwtSecret)
+	o.leases = newLeaseTable(o.queue, o.clock, o.getConfig)
+	o.metrics = newMetrics(o)
+	return o
 }
 
-var (
-	taskQueue      = make(chan *Task, 100)
-	expressions    = make(map[string]*Expression)
-	mu             sync.Mutex
-	operationTimes = map[string]int{
-		"+": 1000,
-		"-": 1000,
-		"*": 2000,
-		"/": 3000,
+// SetTraceExporter - sends spans of expressions to exporter. Must be called before Run, exporter is closed on shutdown
+func (o *Orchestrator) SetTraceExporter(exporter trace.Exporter) {
+	o.tracer = trace.NewTracer("orchestrator", exporter).WithClock(o.clock)
+}
+
+// Reload - applies operation times, queue and retry settings from env without restart
+func (o *Orchestrator) Reload() {
+	if err := o.reloadConfig(); err != nil {
+		slog.Error("Error reloading config", "error", err)
 	}
-)
+}
+
+// Start - starts evaluation of expressions without HTTP server, e.g. when orchestrator is embedded in process.
+// stop interrupts evaluation of unfinished expressions, they get status error, and stops leases
+func (o *Orchestrator) Start() (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	o.evaluationMu.Lock()
+	o.evaluationCtx = ctx
+	o.evaluationMu.Unlock()
+	return func() {
+		cancel()
+		o.leases.stopAll()
+	}
+}
+
+// evaluationContext - context of expression evaluation, it is replaced by Start
+func (o *Orchestrator) evaluationContext() context.Context {
+	o.evaluationMu.RLock()
+	defer o.evaluationMu.RUnlock()
+	return o.evaluationCtx
+}
 
-// Run - register all handlers and allow CORS. Starts server
-func (o *Orchestrator) Run() {
-	loadEnv()
+// Handler - public API of orchestrator, without internal API for agents and CORS
+func (o *Orchestrator) Handler() http.Handler {
+	return o.router()
+}
 
+// router - registers public handlers
+func (o *Orchestrator) router() *mux.Router {
 	r := mux.NewRouter()
+	r.Use(logging.Middleware, o.metricsMiddleware)
+
+	r.HandleFunc("/api/v1/register", o.registerHandler).Methods("POST")
+	r.HandleFunc("/api/v1/login", o.loginHandler).Methods("POST")
+	r.HandleFunc("/api/v1/status", o.getStatusHandler).Methods("GET")
+	r.Handle("/metrics", o.metrics.registry.Handler()).Methods("GET")
+	r.HandleFunc("/healthz", healthzHandler).Methods("GET")
+	r.HandleFunc("/readyz", o.readyzHandler).Methods("GET")
+	r.Handle("/debug/state", o.authMiddleware(requireScope(ScopeAdmin, o.debugStateHandler))).Methods("GET")
+
+	api := r.PathPrefix("/api/v1").Subrouter()
+	api.Use(o.authMiddleware)
+	api.HandleFunc("/calculate", requireScope(ScopeSubmit, o.drainingMiddleware(o.rateLimitMiddleware(o.quotaMiddleware(o.backpressureMiddleware(o.calculateHandler)))))).Methods("POST")
+	api.HandleFunc("/expressions", requireScope(ScopeRead, o.getExpressionsHandler)).Methods("GET")
+	api.HandleFunc("/expressions/{id}", requireScope(ScopeRead, o.getExpressionHandler)).Methods("GET")
+	api.HandleFunc("/expressions/{id}", requireScope(ScopeSubmit, o.cancelExpressionHandler)).Methods("DELETE")
+	api.HandleFunc("/explain", requireScope(ScopeRead, o.explainHandler)).Methods("POST")
+	api.HandleFunc("/stats/cache", requireScope(ScopeRead, o.getCacheStatsHandler)).Methods("GET")
+	api.HandleFunc("/usage", requireScope(ScopeRead, o.getUsageHandler)).Methods("GET")
+	api.HandleFunc("/queue", requireScope(ScopeRead, o.getQueueHandler)).Methods("GET")
+	api.HandleFunc("/admin/keys", requireScope(ScopeAdmin, o.createAPIKeyHandler)).Methods("POST")
+	api.HandleFunc("/admin/keys", requireScope(ScopeAdmin, o.getAPIKeysHandler)).Methods("GET")
+	api.HandleFunc("/admin/keys/{id}", requireScope(ScopeAdmin, o.revokeAPIKeyHandler)).Methods("DELETE")
+	api.HandleFunc("/admin/quotas/{id}", requireScope(ScopeAdmin, o.setQuotaHandler)).Methods("PUT")
+	api.HandleFunc("/admin/weights/{id}", requireScope(ScopeAdmin, o.setWeightHandler)).Methods("PUT")
+	api.HandleFunc("/admin/config", requireScope(ScopeAdmin, o.getConfigHandler)).Methods("GET")
+	api.HandleFunc("/admin/config", requireScope(ScopeAdmin, o.putConfigHandler)).Methods("PUT")
+	api.HandleFunc("/admin/audit", requireScope(ScopeAdmin, o.getAuditHandler)).Methods("GET")
+
+	return r
+}
 
-	r.HandleFunc("/api/v1/calculate", calculateHandler).Methods("POST")
-	r.HandleFunc("/api/v1/expressions", getExpressionsHandler).Methods("GET")
-	r.HandleFunc("/api/v1/expressions/{id}", getExpressionHandler).Methods("GET")
-	r.HandleFunc("/internal/task", sendTaskHandler).Methods("GET")
-	r.HandleFunc("/internal/task", getTaskHandler).Methods("POST")
+// Run - register all handlers and allow CORS. Starts server and blocks until ctx is done, then shuts down gracefully
+func (o *Orchestrator) Run(ctx context.Context) error {
+	if err := o.loadEnv(); err != nil {
+		return err
+	}
+
+	stopEval := o.Start()
+	defer stopEval()
+
+	if err := o.restoreState(o.stateFile); err != nil {
+		slog.Error("Error restoring state", "error", err)
+	}
+
+	r := o.router()
+
+	// both servers report here when they stop, ErrServerClosed is the normal case
+	serveErr := make(chan error, 2)
+
+	var internalServer *http.Server
+	if o.internalCfg.addr == "" {
+		o.registerInternalHandlers(r)
+	} else {
+		internalServer = o.newInternalServer()
+		go func() {
+			if err := o.serveInternal(internalServer); !errors.Is(err, http.ErrServerClosed) {
+				serveErr <- fmt.Errorf("internal server: %w", err)
+			}
+		}()
+	}
 
 	corsHandler := cors.New(cors.Options{
 		AllowedOrigins: []string{"http://localhost:8081"},
 		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"Content-Type", "Authorization"},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "Prefer", "Cache-Control", "X-API-Key", trace.Header, logging.RequestIDHeader},
+		ExposedHeaders: []string{"Retry-After", logging.RequestIDHeader},
 	})
 
-	handler := corsHandler.Handler(r)
+	server := &http.Server{
+		Addr:    pkg.GetEnvWithDefault("PUBLIC_ADDR", ":8080"),
+		Handler: corsHandler.Handler(r),
+	}
+
+	go func() {
+		slog.Info("Starting server", "addr", server.Addr)
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+	}()
 
-	log.Println("Starting server on http://localhost:8080")
-	if err := http.ListenAndServe(":8080", handler); err != nil {
-		log.Fatal("Failed to start server")
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-serveErr:
+		slog.Error("Server failed, shutting down", "error", err)
 	}
+
+	o.shutdown(server, internalServer, stopEval)
+	return err
 }
 
 // loadEnv - loads consts from env
-func loadEnv() {
-	operationTimes["+"] = pkg.GetEnvIntWithDefault("TIME_ADDITION_MS", 1000)
-	operationTimes["-"] = pkg.GetEnvIntWithDefault("TIME_SUBTRACTION_MS", 1000)
-	operationTimes["*"] = pkg.GetEnvIntWithDefault("TIME_MULTIPLICATION_MS", 2000)
-	operationTimes["/"] = pkg.GetEnvIntWithDefault("TIME_DIVISION_MS", 3000)
+func (o *Orchestrator) loadEnv() error {
+	if err := o.loadConfig(pkg.GetEnvWithDefault("CONFIG_FILE", "")); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	o.loadShutdownEnv()
+	o.loadHealthEnv()
+	o.cache.setCapacity(pkg.GetEnvIntWithDefault("CACHE_SIZE", 1000))
+	o.loadAuthEnv(pkg.GetEnvWithDefault("JWT_SECRET", ""), pkg.GetEnvIntWithDefault("JWT_TTL_MIN", 24*60))
+	o.loadAdminKey(pkg.GetEnvWithDefault("ADMIN_API_KEY", ""))
+	o.rateLimits = rateLimitConfig{
+		keyRate:  float64(pkg.GetEnvIntWithDefault("RATE_LIMIT_RPS", 10)),
+		keyBurst: pkg.GetEnvIntWithDefault("RATE_LIMIT_BURST", 20),
+		ipRate:   float64(pkg.GetEnvIntWithDefault("IP_RATE_LIMIT_RPS", 20)),
+		ipBurst:  pkg.GetEnvIntWithDefault("IP_RATE_LIMIT_BURST", 40),
+	}
+	o.usage.defaultQuota = Quota{
+		Operations: pkg.GetEnvIntWithDefault("QUOTA_OPERATIONS_PER_DAY", 0),
+		ComputeMs:  pkg.GetEnvIntWithDefault("QUOTA_COMPUTE_MS_PER_DAY", 0),
+	}
+
+	err := o.loadInternalEnv(
+		pkg.GetEnvWithDefault("INTERNAL_ADDR", ""),
+		pkg.GetEnvWithDefault("AGENT_TOKEN", ""),
+		pkg.GetEnvWithDefault("INTERNAL_TLS_CERT", ""),
+		pkg.GetEnvWithDefault("INTERNAL_TLS_KEY", ""),
+		pkg.GetEnvWithDefault("INTERNAL_CLIENT_CA", ""),
+	)
+	if err != nil {
+		return fmt.Errorf("invalid internal API config: %w", err)
+	}
+	if o.internalCfg.token == "" && o.internalCfg.clientPool == nil {
+		slog.Warn("AGENT_TOKEN is not set, internal API is protected only by INTERNAL_ADDR")
+	}
+	return nil
 }
 
 // calculateHandler - accepts expression from user and returns expressionID
-func calculateHandler(w http.ResponseWriter, r *http.Request) {
+func (o *Orchestrator) calculateHandler(w http.ResponseWriter, r *http.Request) {
 	var req ExpressionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusUnprocessableEntity)
 		return
 	}
 
-	exprID := uuid.New().String()
-
-	expression := &Expression{
-		ID:     exprID,
-		Expr:   req.Expression,
-		Status: "processing",
+	if req.Priority == "" {
+		req.Priority = PriorityNormal
+	}
+	if !validPriority(req.Priority) {
+		http.Error(w, "Invalid priority", http.StatusUnprocessableEntity)
+		return
 	}
 
-	mu.Lock()
-	expressions[exprID] = expression
-	mu.Unlock()
+	wait, err := parseWait(r)
+	if err != nil {
+		http.Error(w, "Invalid wait parameter", http.StatusUnprocessableEntity)
+		return
+	}
 
-	go processExpression(expression)
+	req.NoCache = req.NoCache || r.Header.Get("Cache-Control") == "no-cache"
+	parent, _ := trace.Extract(r.Header)
+	expression := o.submit(r.Context(), userIDFromContext(r.Context()), req, parent)
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
 
-	if err := json.NewEncoder(w).Encode(map[string]string{"id": exprID}); err != nil {
+	if wait > 0 {
+		timeout := make(chan struct{})
+		timer := o.clock.AfterFunc(wait, func() { close(timeout) })
+		defer timer.Stop()
+
+		select {
+		case <-expression.done:
+			w.WriteHeader(http.StatusOK)
+			if err := json.NewEncoder(w).Encode(map[string]interface{}{"expression": expression.snapshot()}); err != nil {
+				http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			}
+			return
+		case <-timeout:
+			w.WriteHeader(http.StatusAccepted)
+		case <-r.Context().Done():
+			return
+		}
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+
+	if err := json.NewEncoder(w).Encode(map[string]string{"id": expression.ID}); err != nil {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 		return
 	}
 }
 
-// processExpression - gets expression and create AST from that. Then evaluates AST
-func processExpression(expr *Expression) {
-	tokens, err := calc.Tokenize(expr.Expr)
-	if err != nil {
-		expr.setStatus("error")
-		log.Println("Error tokenizing expression:", err)
-		return
+// Submit - starts evaluation of expression of owner and returns its ID. The same checks as in public API are made,
+// except rate limits and quotas
+func (o *Orchestrator) Submit(ctx context.Context, ownerID string, req ExpressionRequest) (string, error) {
+	if req.Priority == "" {
+		req.Priority = PriorityNormal
+	}
+	if !validPriority(req.Priority) {
+		return "", ErrInvalidPriority
+	}
+	if o.draining.Load() {
+		return "", ErrShuttingDown
+	}
+	if !o.queue.admit() {
+		return "", ErrQueueFull
+	}
+
+	return o.submit(ctx, ownerID, req, trace.FromContext(ctx)).ID, nil
+}
+
+// submit - saves expression and starts its evaluation in background
+func (o *Orchestrator) submit(ctx context.Context, ownerID string, req ExpressionRequest, parent trace.SpanContext) *Expression {
+	expression := &Expression{
+		ID:          o.newID(),
+		OwnerID:     ownerID,
+		Expr:        req.Expression,
+		Status:      StatusQueued,
+		done:        make(chan struct{}),
+		noCache:     req.NoCache,
+		optimize:    req.Optimize,
+		priority:    req.Priority,
+		traceParent: parent,
+	}
+	o.addExpression(expression)
+
+	o.metrics.expressionsSubmitted.Inc(expression.priority)
+	slog.InfoContext(ctx, "Expression submitted", "expression_id", expression.ID, "owner_id", expression.OwnerID, "priority", expression.priority)
+	go o.processExpression(logging.WithRequestID(o.evaluationContext(), logging.RequestID(ctx)), expression)
+
+	return expression
+}
+
+// addExpression - saves expression. Its final status is counted in metrics
+func (o *Orchestrator) addExpression(expr *Expression) {
+	expr.onFinish = func(status string) {
+		o.metrics.expressionsFinished.Inc(status)
+		select {
+		case o.finished <- struct{}{}:
+		default:
+		}
+	}
+
+	o.store.Save(expr)
+}
+
+// Expression - returns copy of expression with ID
+func (o *Orchestrator) Expression(id string) (*Expression, error) {
+	expr, ok := o.store.Get(id)
+	if !ok {
+		return nil, ErrExpressionNotFound
+	}
+	return expr.snapshot(), nil
+}
+
+// Wait - waits until expression with ID is finished and returns its copy
+func (o *Orchestrator) Wait(ctx context.Context, id string) (*Expression, error) {
+	expr, ok := o.store.Get(id)
+	if !ok {
+		return nil, ErrExpressionNotFound
+	}
+
+	select {
+	case <-expr.done:
+		return expr.snapshot(), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// parseWait - reads wait timeout from ?wait= query or from "Prefer: wait=N" header (N in seconds)
+func parseWait(r *http.Request) (time.Duration, error) {
+	var wait time.Duration
+
+	if value := r.URL.Query().Get("wait"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			seconds, convErr := strconv.Atoi(value)
+			if convErr != nil {
+				return 0, err
+			}
+			d = time.Duration(seconds) * time.Second
+		}
+		wait = d
+	} else {
+		for _, pref := range strings.Split(r.Header.Get("Prefer"), ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(pref), "=")
+			if !strings.EqualFold(name, "wait") {
+				continue
+			}
+			seconds, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return 0, err
+			}
+			wait = time.Duration(seconds) * time.Second
+		}
 	}
 
-	postfix, err := calc.InfixToPostfix(tokens)
-	if err != nil || len(postfix) == 0 {
-		expr.setStatus("error")
-		log.Println("Error converting to postfix:", err)
+	if wait < 0 {
+		return 0, errors.New("negative wait")
+	}
+	if wait > maxWait {
+		wait = maxWait
+	}
+
+	return wait, nil
+}
+
+// processExpression - gets expression and create AST from that. Then evaluates AST. Result of expression is result of root task
+func (o *Orchestrator) processExpression(ctx context.Context, expr *Expression) {
+	logger := slog.With("expression_id", expr.ID)
+
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	expr.mu.Lock()
+	expr.stop = stop
+	expr.mu.Unlock()
+
+	if err := expr.start(); err != nil {
+		if expr.cancelled() {
+			logger.InfoContext(ctx, "Expression cancelled before start")
+			return
+		}
+		logger.ErrorContext(ctx, "Error starting expression", "error", err)
 		return
 	}
 
-	root, err := buildExpressionTree(postfix)
+	ctx, span := o.tracer.Start(trace.ContextWith(ctx, expr.traceParent), "expression")
+	span.SetAttr("expression.id", expr.ID)
+	defer span.End()
+
+	_, root, err := o.parseExpression(ctx, expr.Expr)
 	if err != nil {
-		expr.setStatus("error")
-		log.Println("Error building expression tree:", err)
+		span.SetError(err)
+		expr.fail()
+		logger.WarnContext(ctx, "Error parsing expression", "error", err)
 		return
 	}
 
-	result, err := evaluateNode(root, expr)
+	if expr.optimize {
+		var changes []Optimization
+		root, changes = optimizeTree(root)
+		for _, change := range changes {
+			logger.DebugContext(ctx, "Expression optimized", "rule", change.Rule, "before", change.Before, "after", change.After)
+		}
+	}
+
+	if shared := dedupeSubtrees(root); shared > 0 {
+		logger.DebugContext(ctx, "Repeated subtrees found", "shared", shared)
+	}
+
+	result, err := o.evaluateNode(ctx, root, expr)
+	if ctx.Err() != nil {
+		if expr.cancelled() {
+			span.SetError(ErrExpressionCancelled)
+			logger.InfoContext(ctx, "Expression cancelled")
+			return
+		}
+		// state is already saved by shutdown, so expression must not wait forever
+		span.SetError(ctx.Err())
+		expr.fail()
+		logger.WarnContext(ctx, "Evaluation interrupted by shutdown")
+		return
+	}
 	if err != nil {
-		expr.setStatus("error")
-		log.Println("Error evaluating expression:", err)
+		span.SetError(err)
+		expr.fail()
+		logger.WarnContext(ctx, "Error evaluating expression", "error", err)
 		return
 	}
 
-	expr.setResult(result)
-	expr.setStatus("completed")
-	log.Printf("Complete expression: %v. Status: %v. Result: %v", expr.Expr, expr.Status, result)
+	if err := expr.complete(result); err != nil {
+		logger.ErrorContext(ctx, "Error completing expression", "error", err)
+		return
+	}
+	logger.InfoContext(ctx, "Expression completed", "result", result)
 }
 
-// buildExpressionTree - builds AST from RPN
+// buildExpressionTree - builds AST from RPN with calc.BuildTree and converts it to nodes evaluated by agents
 func buildExpressionTree(postfix []string) (*Node, error) {
-	var stack []*Node
-
-	for _, token := range postfix {
-		if calc.IsNumber(token) {
-			num, _ := strconv.ParseFloat(token, 64)
-			stack = append(stack, &Node{Value: num})
-		} else if calc.IsOperator(token) {
-			if len(stack) < 2 {
-				return nil, errors.New("invalid expression")
-			}
-			right := stack[len(stack)-1]
-			left := stack[len(stack)-2]
-			stack = stack[:len(stack)-2]
-			stack = append(stack, &Node{Operation: token, Left: left, Right: right})
-		} else {
-			return nil, errors.New("invalid token")
-		}
+	root, err := calc.BuildTree(postfix)
+	if err != nil {
+		return nil, err
 	}
+	return fromCalcNode(root), nil
+}
 
-	if len(stack) != 1 {
-		return nil, errors.New("invalid expression")
+// fromCalcNode - copies AST of calc package into orchestrator nodes
+func fromCalcNode(n *calc.Node) *Node {
+	if n == nil {
+		return nil
+	}
+	return &Node{
+		Value:     n.Value,
+		Operation: n.Operation,
+		Left:      fromCalcNode(n.Left),
+		Right:     fromCalcNode(n.Right),
 	}
-
-	return stack[0], nil
 }
 
-// evaluateNode - recursive function, that creates task for every operation in AST
-func evaluateNode(node *Node, expr *Expression) (float64, error) {
+// evaluateNode - recursive function, that creates task for every operation in AST. Subtrees are evaluated in parallel,
+// shared subtrees are evaluated only once
+func (o *Orchestrator) evaluateNode(ctx context.Context, node *Node, expr *Expression) (float64, error) {
 	if node.Operation == "" {
 		return node.Value, nil
 	}
 
-	var left, right float64
-	var err error
+	node.once.Do(func() {
+		node.result, node.err = o.evaluateOperation(ctx, node, expr)
+	})
+
+	return node.result, node.err
+}
+
+// evaluateOperation - evaluates children of node and gets result of operation from cache, identical task in flight or agent
+func (o *Orchestrator) evaluateOperation(ctx context.Context, node *Node, expr *Expression) (float64, error) {
+	var left float64
+	var leftErr error
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		left, leftErr = o.evaluateNode(ctx, node.Left, expr)
+	}()
 
-	left, err = evaluateNode(node.Left, expr)
+	right, err := o.evaluateNode(ctx, node.Right, expr)
+	wg.Wait()
+	if leftErr != nil {
+		return 0, leftErr
+	}
 	if err != nil {
 		return 0, err
 	}
 
-	right, err = evaluateNode(node.Right, expr)
-	if err != nil {
+	// expression could be cancelled while its subtrees were calculated
+	if err := ctx.Err(); err != nil {
 		return 0, err
 	}
 
+	_, span := o.tracer.Start(ctx, "task")
+	defer span.End()
+
 	task := &Task{
-		ID:            uuid.New().String(),
+		ID:            o.newID(),
 		ExpressionID:  expr.ID,
 		Operation:     node.Operation,
 		Arg1:          left,
 		Arg2:          right,
 		Status:        "queued",
-		OperationTime: operationTimes[node.Operation],
+		OperationTime: o.operationTime(node.Operation),
+		createdAt:     o.clock.Now(),
+		done:          make(chan struct{}),
+		expr:          expr,
+		priority:      expr.priority,
+		ownerID:       expr.OwnerID,
+		traceCtx:      span.Context(),
 	}
+	span.SetAttr("task.id", task.ID)
+	span.SetAttr("operation", task.Operation)
 
-	expr.addTask(task)
-	taskQueue <- task
-
-	resultChan := make(chan float64)
-	go func() {
-		for {
-			taskStatus := getTaskStatus(task.ID, expr.ID)
-			if taskStatus == "completed" {
-				resultChan <- getTaskResult(task.ID, expr.ID)
-				close(resultChan)
-				return
-			}
-			time.Sleep(100 * time.Millisecond)
+	key := taskKey(node.Operation, left, right)
+	for !expr.noCache {
+		result, leader, hit := o.cache.acquire(key, task)
+		if !hit {
+			break
 		}
-	}()
+		if leader == nil {
+			span.SetAttr("cache", "hit")
+			return result, nil
+		}
+		span.SetAttr("cache", "inflight")
+		select {
+		case <-leader.done:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+		// expression of leader was cancelled, so the task is calculated again
+		if errors.Is(leader.err, ErrExpressionCancelled) {
+			o.cache.abandon(key, leader)
+			continue
+		}
+		return leader.Result, leader.err
+	}
+
+	node.Task = task
+	o.enqueue(expr, task)
 
 	select {
-	case result := <-resultChan:
-		return result, nil
+	case <-task.done:
+	case <-ctx.Done():
+		if !expr.noCache {
+			o.cache.abandon(key, task)
+		}
+		return 0, ctx.Err()
 	}
-}
 
-// getTaskStatus - gets status of task in expression
-func getTaskStatus(taskID, exprID string) string {
-	mu.Lock()
-	expr, exists := expressions[exprID]
-	mu.Unlock()
-
-	if !exists {
-		return ""
+	if task.err != nil {
+		span.SetError(task.err)
+		if !expr.noCache {
+			o.cache.abandon(key, task)
+		}
+		return 0, task.err
 	}
 
-	expr.mu.Lock()
-	defer expr.mu.Unlock()
+	o.usage.record(expr.OwnerID, task.OperationTime, o.clock.Now())
 
-	for _, task := range expr.Tasks {
-		if task.ID == taskID {
-			return task.Status
-		}
+	if !expr.noCache {
+		o.cache.release(key, task.Result)
 	}
-	return ""
-}
 
-// getTaskStatus - gets result of task in expression
-func getTaskResult(taskID, exprID string) float64 {
-	mu.Lock()
-	expr, exists := expressions[exprID]
-	mu.Unlock()
+	return task.Result, nil
+}
 
-	if !exists {
-		return 0
+// complete - saves result of task and wakes up its waiter. Must be called with expression mutex held
+func (t *Task) complete(result float64) {
+	if t.finished() {
+		return
 	}
+	t.Result = result
+	t.Status = "completed"
+	close(t.done)
+}
 
-	expr.mu.Lock()
-	defer expr.mu.Unlock()
+// fail - finishes task with error and wakes up its waiter. Must be called with expression mutex held
+func (t *Task) fail(err error) {
+	if t.finished() {
+		return
+	}
+	t.err = err
+	t.Status = "error"
+	close(t.done)
+}
 
-	for _, task := range expr.Tasks {
-		if task.ID == taskID && task.Status == "completed" {
-			return task.Result
-		}
+// finished - checks if task got result or failed
+func (t *Task) finished() bool {
+	select {
+	case <-t.done:
+		return true
+	default:
+		return false
 	}
-	return 0
 }
 
-func (e *Expression) setStatus(status string) {
-	e.mu.Lock()
-	defer e.mu.Unlock()
-	e.Status = status
+// TraceContext - span of task, spans of agent are its children
+func (t *Task) TraceContext() trace.SpanContext {
+	return t.traceCtx
 }
 
-func (e *Expression) setResult(result float64) {
+// snapshot - returns copy of expression that is safe to encode
+func (e *Expression) snapshot() *Expression {
 	e.mu.Lock()
 	defer e.mu.Unlock()
-	e.Result = result
+
+	// tasks are copied, so their status can be read without lock of expression
+	tasks := make([]*Task, len(e.Tasks))
+	for i, task := range e.Tasks {
+		tasks[i] = &Task{
+			ID:            task.ID,
+			ExpressionID:  task.ExpressionID,
+			Operation:     task.Operation,
+			Arg1:          task.Arg1,
+			Arg2:          task.Arg2,
+			Result:        task.Result,
+			Status:        task.Status,
+			OperationTime: task.OperationTime,
+		}
+	}
+
+	return &Expression{
+		ID:      e.ID,
+		OwnerID: e.OwnerID,
+		Expr:    e.Expr,
+		Status:  e.Status,
+		Result:  e.Result,
+		Tasks:   tasks,
+	}
 }
 
+// enqueue - adds task to expression and pushes it to queue under expression mutex, so cancel either fails task
+// before it is queued or finds it in queue
+func (o *Orchestrator) enqueue(expr *Expression, task *Task) {
+	expr.mu.Lock()
+	defer expr.mu.Unlock()
+
+	expr.addTask(task)
+	if !task.finished() {
+		o.queue.push(task)
+	}
+}
+
+// addTask - saves task in expression. Must be called with expression mutex held
 func (e *Expression) addTask(task *Task) {
-	e.mu.Lock()
-	defer e.mu.Unlock()
+	if e.taskByID == nil {
+		e.taskByID = make(map[string]*Task)
+	}
 	e.Tasks = append(e.Tasks, task)
+	e.taskByID[task.ID] = task
+	// expression was cancelled after evaluation checked it, task must not reach agent
+	if e.Status == StatusCancelled {
+		task.fail(ErrExpressionCancelled)
+	}
 }
 
-// getExpressionsHandler - creates list with all expressions and return that
-func getExpressionsHandler(w http.ResponseWriter, r *http.Request) {
-	mu.Lock()
-	defer mu.Unlock()
-
-	var exprList []*Expression
-	for _, expr := range expressions {
-		expr.mu.Lock()
-		exprCopy := &Expression{
-			ID:     expr.ID,
-			Expr:   expr.Expr,
-			Status: expr.Status,
-			Result: expr.Result,
-			Tasks:  expr.Tasks,
+// getExpressionsHandler - creates list with all expressions of user and return that
+func (o *Orchestrator) getExpressionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := userIDFromContext(r.Context())
+
+	exprList := []*Expression{}
+	for _, expr := range o.store.List() {
+		if expr.OwnerID != userID {
+			continue
 		}
-		exprList = append(exprList, exprCopy)
-		expr.mu.Unlock()
+		exprList = append(exprList, expr.snapshot())
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	log.Println("Get all expressions")
+	slog.DebugContext(r.Context(), "Get all expressions", "count", len(exprList))
 
 	if err := json.NewEncoder(w).Encode(map[string]interface{}{"expressions": exprList}); err != nil {
 		http.Error(w, "Error encoding expressions", http.StatusInternalServerError)
@@ -303,51 +769,173 @@ func getExpressionsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// getExpressionHandler - gets expression with ID
-func getExpressionHandler(w http.ResponseWriter, r *http.Request) {
+// getExpressionHandler - gets expression with ID. Expressions of other users are not found
+func (o *Orchestrator) getExpressionHandler(w http.ResponseWriter, r *http.Request) {
 	exprID := mux.Vars(r)["id"]
 
-	mu.Lock()
-	expr, ok := expressions[exprID]
-	mu.Unlock()
+	exprCopy, err := o.Expression(exprID)
+	if err != nil || exprCopy.OwnerID != userIDFromContext(r.Context()) {
+		http.Error(w, "Expression not found", http.StatusNotFound)
+		return
+	}
 
-	if !ok {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	slog.DebugContext(r.Context(), "Get expression", "expression_id", exprID)
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"expression": exprCopy}); err != nil {
+		http.Error(w, "Error encoding expression", http.StatusInternalServerError)
+		return
+	}
+}
+
+// cancelExpressionHandler - cancels expression of user. Its queued tasks are not sent to agents anymore
+func (o *Orchestrator) cancelExpressionHandler(w http.ResponseWriter, r *http.Request) {
+	exprID := mux.Vars(r)["id"]
+
+	expr, ok := o.store.Get(exprID)
+	if !ok || expr.OwnerID != userIDFromContext(r.Context()) {
 		http.Error(w, "Expression not found", http.StatusNotFound)
 		return
 	}
 
-	expr.mu.Lock()
-	exprCopy := &Expression{
-		ID:     expr.ID,
-		Expr:   expr.Expr,
-		Status: expr.Status,
-		Result: expr.Result,
-		Tasks:  expr.Tasks,
+	if err := expr.cancel(); err != nil {
+		http.Error(w, "Expression is already finished", http.StatusConflict)
+		return
 	}
-	expr.mu.Unlock()
+	o.dequeue(expr)
+	slog.InfoContext(r.Context(), "Expression cancel requested", "expression_id", exprID)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	log.Printf("Get expression: %v", expr.Expr)
 
-	if err := json.NewEncoder(w).Encode(map[string]interface{}{"expression": exprCopy}); err != nil {
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"expression": expr.snapshot()}); err != nil {
 		http.Error(w, "Error encoding expression", http.StatusInternalServerError)
 		return
 	}
 }
 
+// dequeue - removes finished tasks of expression from queue, so they don't count in its depth
+func (o *Orchestrator) dequeue(expr *Expression) {
+	expr.mu.Lock()
+	tasks := append([]*Task(nil), expr.Tasks...)
+	expr.mu.Unlock()
+
+	for _, task := range tasks {
+		o.queue.remove(task)
+	}
+}
+
+// getCacheStatsHandler - returns hit rate and counters of task result cache
+func (o *Orchestrator) getCacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"cache": o.cache.stats()}); err != nil {
+		http.Error(w, "Error encoding stats", http.StatusInternalServerError)
+		return
+	}
+}
+
+// LeaseTask - gives next task from queue to agent. Returns nil if there are no tasks, and amount of tasks left in queue
+func (o *Orchestrator) LeaseTask(ctx context.Context, agentID string) (*Task, int) {
+	var task *Task
+	var taskCopy Task
+	for task == nil {
+		next, ok := o.queue.pop()
+		if !ok {
+			return nil, o.queue.len()
+		}
+
+		// task could get result from previous agent while it was waiting for retry, or be cancelled
+		next.expr.mu.Lock()
+		if !next.finished() {
+			next.Status = "processing"
+			taskCopy = *next
+			task = next
+		}
+		next.expr.mu.Unlock()
+	}
+
+	o.metrics.taskQueueWait.Observe(o.clock.Now().Sub(task.queuedAt).Seconds(), task.Operation)
+
+	_, wait := o.tracer.StartAt(trace.ContextWith(ctx, taskCopy.traceCtx), "queue_wait", task.queuedAt)
+	wait.SetAttr("attempt", strconv.Itoa(taskCopy.attempts+1))
+	wait.End()
+
+	o.leases.grant(task, agentID)
+	slog.DebugContext(ctx, "Task leased", "task_id", task.ID, "expression_id", task.ExpressionID, "agent_id", agentID)
+
+	return &taskCopy, o.queue.len()
+}
+
+// CompleteTask - saves result of task calculated by agent and wakes up its parent node. Task with error or
+// non-finite result fails. Duplicate results are ignored
+func (o *Orchestrator) CompleteTask(ctx context.Context, agentID string, taskResult TaskResult) error {
+	task, ok := o.findTask(taskResult.ExpressionID, taskResult.ID)
+	if !ok {
+		return ErrTaskNotFound
+	}
+
+	task.expr.mu.Lock()
+	first := !task.finished()
+	// Inf and NaN can't be encoded to JSON and mean division by zero, so expression fails at once
+	if taskResult.Error != "" || math.IsInf(taskResult.Result, 0) || math.IsNaN(taskResult.Result) {
+		task.fail(calc.ErrDivisionByZero)
+	} else {
+		task.complete(taskResult.Result)
+	}
+	task.expr.mu.Unlock()
+	o.leases.release(task.ID)
+	// result of expired lease can come while task waits in queue for retry
+	o.queue.remove(task)
+	slog.DebugContext(ctx, "Task result received", "task_id", task.ID, "expression_id", task.ExpressionID, "agent_id", agentID, "duplicate", !first)
+
+	if first {
+		o.metrics.taskDuration.Observe(o.clock.Now().Sub(task.createdAt).Seconds(), task.Operation)
+	}
+	return nil
+}
+
+// ReleaseTask - agent returns task it won't calculate, e.g. when shutting down
+func (o *Orchestrator) ReleaseTask(ctx context.Context, agentID string, taskResult TaskResult) error {
+	task, ok := o.findTask(taskResult.ExpressionID, taskResult.ID)
+	if !ok {
+		return ErrTaskNotFound
+	}
+
+	o.leases.handBack(task)
+	return nil
+}
+
 // sendTaskHandler - internal function for agent. Send one task from queue
-func sendTaskHandler(w http.ResponseWriter, r *http.Request) {
-	select {
-	case task := <-taskQueue:
-		json.NewEncoder(w).Encode(map[string]interface{}{"task": task})
-	default:
+func (o *Orchestrator) sendTaskHandler(w http.ResponseWriter, r *http.Request) {
+	task, depth := o.LeaseTask(r.Context(), r.Header.Get(agentIDHeader))
+	// hint for agent autoscaling: how many tasks are still waiting
+	w.Header().Set("X-Queue-Depth", strconv.Itoa(depth))
+	if task == nil {
 		http.Error(w, "No tasks available", http.StatusNotFound)
+		return
+	}
+
+	data, err := json.Marshal(map[string]interface{}{"task": task})
+	if err != nil {
+		// agent won't get the task, so it goes back to queue instead of waiting for lease to expire
+		slog.ErrorContext(r.Context(), "Error encoding task", "task_id", task.ID, "error", err)
+		o.ReleaseTask(r.Context(), r.Header.Get(agentIDHeader), TaskResult{ID: task.ID, ExpressionID: task.ExpressionID})
+		http.Error(w, "Error encoding task", http.StatusInternalServerError)
+		return
+	}
+
+	trace.Inject(w.Header(), task.traceCtx)
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(data); err != nil {
+		slog.ErrorContext(r.Context(), "Error sending task", "task_id", task.ID, "error", err)
 	}
 }
 
-// getTaskHandler - internal function for agent. Gets task from agent and checks if all expression is completed
-func getTaskHandler(w http.ResponseWriter, r *http.Request) {
+// getTaskHandler - internal function for agent. Gets task result from agent and wakes up its parent node
+func (o *Orchestrator) getTaskHandler(w http.ResponseWriter, r *http.Request) {
 	var taskResult TaskResult
 
 	if err := json.NewDecoder(r.Body).Decode(&taskResult); err != nil {
@@ -355,40 +943,41 @@ func getTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	mu.Lock()
-	expr, ok := expressions[taskResult.ExpressionID]
-	mu.Unlock()
-
-	if !ok {
+	if err := o.CompleteTask(r.Context(), r.Header.Get(agentIDHeader), taskResult); err != nil {
 		http.Error(w, "Task not found", http.StatusNotFound)
 		return
 	}
 
-	expr.mu.Lock()
-	defer expr.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
 
-	for _, task := range expr.Tasks {
-		if task.ID == taskResult.ID {
-			task.Result = taskResult.Result
-			task.Status = "completed"
-			break
-		}
-	}
+// releaseTaskHandler - internal function for agent. Agent returns task it won't calculate, e.g. when shutting down
+func (o *Orchestrator) releaseTaskHandler(w http.ResponseWriter, r *http.Request) {
+	var taskResult TaskResult
 
-	allCompleted := true
-	var finalResult float64
-	for _, task := range expr.Tasks {
-		if task.Status != "completed" {
-			allCompleted = false
-			break
-		}
-		finalResult = task.Result
+	if err := json.NewDecoder(r.Body).Decode(&taskResult); err != nil {
+		http.Error(w, "Invalid request", http.StatusUnprocessableEntity)
+		return
 	}
 
-	if allCompleted {
-		expr.Result = finalResult
-		expr.Status = "completed"
+	if err := o.ReleaseTask(r.Context(), r.Header.Get(agentIDHeader), taskResult); err != nil {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
+
+// findTask - finds task by its ID and ID of its expression
+func (o *Orchestrator) findTask(exprID, taskID string) (*Task, bool) {
+	expr, ok := o.store.Get(exprID)
+	if !ok {
+		return nil, false
+	}
+
+	expr.mu.Lock()
+	defer expr.mu.Unlock()
+
+	task, ok := expr.taskByID[taskID]
+	return task, ok
+}
@@ -0,0 +1,728 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/calc"
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/clock"
+	"github.com/google/uuid"
+)
+
+// fakeAgent - takes tasks from queue and sends results back through getTaskHandler
+func fakeAgent(o *Orchestrator, stop <-chan struct{}) {
+	for {
+		task, ok := o.queue.pop()
+		if !ok {
+			select {
+			case <-stop:
+				return
+			case <-o.queue.ready():
+			}
+			continue
+		}
+
+		var result float64
+		switch task.Operation {
+		case "+":
+			result = task.Arg1 + task.Arg2
+		case "-":
+			result = task.Arg1 - task.Arg2
+		case "*":
+			result = task.Arg1 * task.Arg2
+		case "/":
+			result = task.Arg1 / task.Arg2
+		}
+
+		data, _ := json.Marshal(TaskResult{ID: task.ID, Result: result, ExpressionID: task.ExpressionID})
+		req := httptest.NewRequest(http.MethodPost, "/internal/task", bytes.NewReader(data))
+		o.getTaskHandler(httptest.NewRecorder(), req)
+	}
+}
+
+func buildTree(tb testing.TB, expression string) *Node {
+	tb.Helper()
+
+	tokens, err := calc.Tokenize(expression)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	postfix, err := calc.InfixToPostfix(tokens)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	root, err := buildExpressionTree(postfix)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return root
+}
+
+func BenchmarkEvaluateNode(b *testing.B) {
+	o := NewOrchestrator()
+	stop := make(chan struct{})
+	defer close(stop)
+	for i := 0; i < 4; i++ {
+		go fakeAgent(o, stop)
+	}
+
+	operands := make([]string, 20)
+	for i := range operands {
+		operands[i] = strconv.Itoa(i + 1)
+	}
+	expression := strings.Join(operands, "+")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		root := buildTree(b, expression)
+		expr := &Expression{ID: uuid.New().String(), Expr: expression, Status: StatusProcessing, done: make(chan struct{}), noCache: true}
+
+		o.addExpression(expr)
+
+		result, err := o.evaluateNode(context.Background(), root, expr)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if result != 210 {
+			b.Fatalf("expected 210, got %v", result)
+		}
+	}
+}
+
+func TestExpressionTransitions(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     string
+		to       string
+		expected error
+	}{
+		{name: "Queued to processing", from: StatusQueued, to: StatusProcessing},
+		{name: "Processing to completed", from: StatusProcessing, to: StatusCompleted},
+		{name: "Processing to error", from: StatusProcessing, to: StatusError},
+		{name: "Processing to cancelled", from: StatusProcessing, to: StatusCancelled},
+		{name: "Queued to completed", from: StatusQueued, to: StatusCompleted, expected: ErrIllegalTransition},
+		{name: "Completed to processing", from: StatusCompleted, to: StatusProcessing, expected: ErrIllegalTransition},
+		{name: "Cancelled to completed", from: StatusCancelled, to: StatusCompleted, expected: ErrIllegalTransition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr := &Expression{Status: tt.from, done: make(chan struct{})}
+			err := expr.transition(tt.to)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("expected error %v, got %v", tt.expected, err)
+			}
+			if tt.expected == nil && expr.Status != tt.to {
+				t.Errorf("expected status %v, got %v", tt.to, expr.Status)
+			}
+		})
+	}
+}
+
+func TestResultIsRootTask(t *testing.T) {
+	o := NewOrchestrator()
+	stop := make(chan struct{})
+	defer close(stop)
+	go fakeAgent(o, stop)
+
+	expr := &Expression{ID: uuid.New().String(), Expr: "(1+2)*3-4/2", Status: StatusQueued, done: make(chan struct{})}
+	o.addExpression(expr)
+
+	o.processExpression(context.Background(), expr)
+
+	got := expr.snapshot()
+	if got.Status != StatusCompleted || got.Result != 7 {
+		t.Errorf("expected completed with 7, got %v with %v", got.Status, got.Result)
+	}
+}
+
+func TestCancelExpression(t *testing.T) {
+	o := NewOrchestrator()
+	expr := &Expression{ID: uuid.New().String(), Expr: "2*3", Status: StatusQueued, noCache: true, done: make(chan struct{})}
+
+	finished := make(chan struct{})
+	go func() {
+		o.processExpression(context.Background(), expr)
+		close(finished)
+	}()
+
+	var task *Task
+	for task == nil {
+		time.Sleep(time.Millisecond)
+		expr.mu.Lock()
+		if len(expr.Tasks) > 0 {
+			task = expr.Tasks[0]
+		}
+		expr.mu.Unlock()
+	}
+
+	if err := expr.cancel(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	o.dequeue(expr)
+	if stats := o.queue.stats(); stats.Depth != 0 || stats.Priority[PriorityNormal] != 0 {
+		t.Errorf("expected cancelled task to leave queue, got %+v", stats)
+	}
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("evaluation was not stopped")
+	}
+
+	if !task.finished() || !errors.Is(task.err, ErrExpressionCancelled) {
+		t.Errorf("expected queued task to be cancelled, got %v", task.err)
+	}
+	if got := expr.snapshot(); got.Status != StatusCancelled {
+		t.Errorf("expected cancelled, got %v", got.Status)
+	}
+	if err := expr.cancel(); !errors.Is(err, ErrIllegalTransition) {
+		t.Errorf("expected second cancel to fail, got %v", err)
+	}
+}
+
+func TestResultCache(t *testing.T) {
+	c := newResultCache(2)
+
+	leader := &Task{ID: "1"}
+	if _, owner, hit := c.acquire(taskKey("+", 1, 2), leader); hit || owner != nil {
+		t.Fatalf("expected miss for new key")
+	}
+	if _, owner, hit := c.acquire(taskKey("+", 1, 2), &Task{ID: "2"}); !hit || owner != leader {
+		t.Fatalf("expected identical task in flight")
+	}
+
+	c.release(taskKey("+", 1, 2), 3)
+	c.acquire(taskKey("*", 2, 2), &Task{})
+	c.release(taskKey("*", 2, 2), 4)
+	c.acquire(taskKey("-", 5, 1), &Task{})
+	c.release(taskKey("-", 5, 1), 4)
+
+	if _, _, hit := c.acquire(taskKey("+", 1, 2), &Task{}); hit {
+		t.Errorf("expected least recently used result to be evicted")
+	}
+	if result, _, hit := c.acquire(taskKey("-", 5, 1), &Task{}); !hit || result != 4 {
+		t.Errorf("expected cached result 4, got %v", result)
+	}
+
+	stats := c.stats()
+	if stats.Hits != 1 || stats.InflightHits != 1 || stats.Misses != 4 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestDedupeSubtrees(t *testing.T) {
+	root := buildTree(t, "(1+2)*(1+2)-(1+2)")
+	if shared := dedupeSubtrees(root); shared != 2 {
+		t.Errorf("expected 2 shared subtrees, got %v", shared)
+	}
+	if root.Left.Left != root.Left.Right || root.Left.Left != root.Right {
+		t.Errorf("expected repeated subtrees to share one node")
+	}
+}
+
+func TestOptimizeTree(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		expected   string
+		operations int
+	}{
+		{name: "Multiply by one", input: "(2+3)*1", expected: "(2+3)", operations: 1},
+		{name: "Add zero", input: "0+(2-3)+0", expected: "(2-3)", operations: 1},
+		{name: "Multiply by zero", input: "(2+3)*0", expected: "0", operations: 0},
+		{name: "Subtract itself", input: "(2*3)-(2*3)+4", expected: "4", operations: 0},
+		{name: "Balance chain", input: "2*3*4*5", expected: "((2*3)*(4*5))", operations: 3},
+	}
+
+	// division by zero must fail after optimization too
+	for _, input := range []string{"(1/0)*0", "0*(1/0)", "(1/0)-(1/0)"} {
+		root, changes := optimizeTree(buildTree(t, input))
+		if len(changes) != 0 || !hasDivision(root) {
+			t.Errorf("expected %v to stay unchanged, got %v", input, formatNode(root))
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, changes := optimizeTree(buildTree(t, tt.input))
+			if got := formatNode(root); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+			if got := countOperations(root); got != tt.operations {
+				t.Errorf("expected %v operations, got %v", tt.operations, got)
+			}
+			if len(changes) == 0 {
+				t.Errorf("expected changes to be recorded")
+			}
+		})
+	}
+}
+
+func TestOptimizeLongChain(t *testing.T) {
+	operands := make([]string, 100)
+	for i := range operands {
+		operands[i] = strconv.Itoa(i + 1)
+	}
+
+	root, _ := optimizeTree(buildTree(t, strings.Join(operands, "+")))
+	if got := depth(root); got != 7 {
+		t.Errorf("expected depth 7, got %v", got)
+	}
+	if got := countOperations(root); got != 99 {
+		t.Errorf("expected 99 operations, got %v", got)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter()
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.allow("key", 1, 3, now); !ok {
+			t.Fatalf("expected request %v to be allowed by burst", i)
+		}
+	}
+
+	ok, wait := l.allow("key", 1, 3, now)
+	if ok || wait != time.Second {
+		t.Errorf("expected rejection with 1s wait, got %v %v", ok, wait)
+	}
+
+	if ok, _ := l.allow("key", 1, 3, now.Add(time.Second)); !ok {
+		t.Errorf("expected token to be refilled after 1s")
+	}
+	if ok, _ := l.allow("other", 1, 3, now); !ok {
+		t.Errorf("expected buckets to be independent")
+	}
+}
+
+func TestUsageQuota(t *testing.T) {
+	u := newUsageTracker()
+	u.defaultQuota = Quota{ComputeMs: 3000}
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	u.record("user", 2000, now)
+	if u.exceeded("user", now) {
+		t.Errorf("expected quota not to be exceeded")
+	}
+
+	u.record("user", 1000, now)
+	if !u.exceeded("user", now) {
+		t.Errorf("expected quota to be exceeded")
+	}
+	if u.exceeded("user", now.Add(12*time.Hour)) {
+		t.Errorf("expected quota to be reset next day")
+	}
+
+	u.setQuota("user", Quota{Operations: 10})
+	if u.exceeded("user", now) {
+		t.Errorf("expected personal quota to be used")
+	}
+}
+
+func TestSchedulerFairness(t *testing.T) {
+	s := newScheduler()
+	for i := 0; i < 10; i++ {
+		s.Push(&Task{ID: "big", ownerID: "big", priority: PriorityNormal})
+	}
+	s.Push(&Task{ID: "small", ownerID: "small", priority: PriorityNormal})
+
+	first, _ := s.Pop()
+	second, _ := s.Pop()
+	if first.ID != "small" && second.ID != "small" {
+		t.Errorf("expected task of small owner in first two, got %v and %v", first.ID, second.ID)
+	}
+
+	s = newScheduler()
+	for i := 0; i < 8; i++ {
+		s.Push(&Task{ID: "low", ownerID: "user", priority: PriorityLow})
+		s.Push(&Task{ID: "high", ownerID: "user", priority: PriorityHigh})
+	}
+
+	high := 0
+	for i := 0; i < 5; i++ {
+		task, _ := s.Pop()
+		if task.ID == "high" {
+			high++
+		}
+	}
+	if high != 4 {
+		t.Errorf("expected 4 of 5 tasks with high priority, got %v", high)
+	}
+	if depths := s.Depths(); depths[PriorityHigh] != 4 || depths[PriorityLow] != 7 {
+		t.Errorf("unexpected depths %v", depths)
+	}
+}
+
+func TestSchedulerAdmission(t *testing.T) {
+	s := newTaskQueue(newScheduler(), clock.Real())
+	s.setLimit(2)
+
+	s.push(&Task{priority: PriorityNormal})
+	if !s.admit() {
+		t.Errorf("expected expression to be admitted below limit")
+	}
+
+	s.push(&Task{priority: PriorityNormal})
+	s.push(&Task{priority: PriorityNormal})
+	if s.admit() {
+		t.Errorf("expected expression to be rejected over limit")
+	}
+
+	stats := s.stats()
+	if stats.Depth != 3 || stats.Accepting || stats.Rejected != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	s.pop()
+	s.pop()
+	if !s.admit() {
+		t.Errorf("expected expression to be admitted after queue drained")
+	}
+
+	// finished task is removed without being popped
+	cancelled := &Task{priority: PriorityNormal}
+	s.push(cancelled)
+	s.push(&Task{priority: PriorityNormal})
+	s.remove(cancelled)
+	s.remove(cancelled)
+	if stats := s.stats(); stats.Depth != 2 || stats.Accepting {
+		t.Errorf("expected removed task not to count in depth, got %+v", stats)
+	}
+	if task, _ := s.pop(); task == cancelled {
+		t.Errorf("expected removed task not to be popped")
+	}
+}
+
+func TestRestoreState(t *testing.T) {
+	expr := &Expression{ID: uuid.New().String(), OwnerID: "user", Expr: "2*(3+4)", Status: StatusQueued, done: make(chan struct{}), priority: PriorityHigh}
+	saved := NewOrchestrator()
+	saved.addExpression(expr)
+
+	path := t.TempDir() + "/state.json"
+	if err := saved.saveState(path); err != nil {
+		t.Fatal(err)
+	}
+
+	o := NewOrchestrator()
+	stop := make(chan struct{})
+	defer close(stop)
+	go fakeAgent(o, stop)
+
+	if err := o.restoreState(path); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, ok := o.store.Get(expr.ID)
+	if !ok {
+		t.Fatalf("expected expression %v to be restored", expr.ID)
+	}
+
+	select {
+	case <-restored.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("restored expression was not calculated")
+	}
+
+	got := restored.snapshot()
+	if got.Status != StatusCompleted || got.Result != 14 || restored.OwnerID != "user" {
+		t.Errorf("expected completed with 14 for user, got %v with %v for %v", got.Status, got.Result, restored.OwnerID)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected state file to be removed, got %v", err)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	o := NewOrchestrator()
+	o.agents = newAgentRegistry(time.Minute, clock.Real())
+
+	rec := httptest.NewRecorder()
+	o.readyzHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 without agents, got %v", rec.Code)
+	}
+
+	o.RecordHeartbeat(Heartbeat{ID: "agent-1", Workers: 4, Busy: 1}, "127.0.0.1:1234")
+
+	rec = httptest.NewRecorder()
+	o.readyzHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200 with active agent, got %v: %v", rec.Code, rec.Body.String())
+	}
+
+	list := o.agents.list()
+	if len(list) != 1 || !list[0].Active || list[0].Workers != 4 {
+		t.Errorf("unexpected agents %+v", list)
+	}
+}
+
+func TestDeterministicLease(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	ids := 0
+	o := NewOrchestrator(
+		WithClock(fake),
+		WithIDGenerator(func() string {
+			ids++
+			return "id-" + strconv.Itoa(ids)
+		}),
+		WithOperationTimes(map[string]time.Duration{"*": 100 * time.Millisecond}),
+	)
+
+	id, err := o.Submit(context.Background(), "user", ExpressionRequest{Expression: "2*3"})
+	if err != nil || id != "id-1" {
+		t.Fatalf("expected id-1, got %q (%v)", id, err)
+	}
+	for o.queue.len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	task, _ := o.LeaseTask(context.Background(), "agent-1")
+	if task == nil || task.ID != "id-2" || task.OperationTime != 100 {
+		t.Fatalf("expected task id-2 with 100ms, got %+v", task)
+	}
+
+	fake.Advance(time.Duration(task.OperationTime+o.Config().LeaseTimeoutMs) * time.Millisecond)
+	if o.queue.len() != 1 {
+		t.Fatalf("expected expired task to be returned to queue")
+	}
+
+	task, _ = o.LeaseTask(context.Background(), "agent-2")
+	if task == nil || task.ID != "id-2" {
+		t.Fatalf("expected task id-2 again, got %+v", task)
+	}
+	if err := o.CompleteTask(context.Background(), "agent-2", TaskResult{ID: task.ID, ExpressionID: id, Result: 6}); err != nil {
+		t.Fatal(err)
+	}
+
+	expr, err := o.Wait(context.Background(), id)
+	if err != nil || expr.Status != StatusCompleted || expr.Result != 6 {
+		t.Errorf("expected completed with 6, got %+v (%v)", expr, err)
+	}
+}
+
+func TestLeaseCancelledTask(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	o := NewOrchestrator(WithClock(fake))
+
+	submit := func(expression string) *Expression {
+		t.Helper()
+		before := o.queue.len()
+		id, err := o.Submit(context.Background(), "user", ExpressionRequest{Expression: expression})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for o.queue.len() == before {
+			time.Sleep(time.Millisecond)
+		}
+		expr, _ := o.store.Get(id)
+		return expr
+	}
+
+	// cancelled while leased: neither hand back nor expired lease returns it to queue
+	leased := submit("2*3")
+	task, _ := o.LeaseTask(context.Background(), "agent-1")
+	if task == nil {
+		t.Fatal("expected task")
+	}
+	if err := leased.cancel(); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.ReleaseTask(context.Background(), "agent-1", TaskResult{ID: task.ID, ExpressionID: leased.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if n := o.queue.len(); n != 0 {
+		t.Errorf("expected cancelled task not to be handed back, got %v in queue", n)
+	}
+
+	leased = submit("4*5")
+	task, _ = o.LeaseTask(context.Background(), "agent-1")
+	if err := leased.cancel(); err != nil {
+		t.Fatal(err)
+	}
+	fake.Advance(time.Duration(task.OperationTime+o.Config().LeaseTimeoutMs) * time.Millisecond)
+	if n := o.queue.len(); n != 0 {
+		t.Errorf("expected cancelled task not to be returned after lease expired, got %v in queue", n)
+	}
+
+	// cancelled while queued: never given to agent
+	queued := submit("6*7")
+	if err := queued.cancel(); err != nil {
+		t.Fatal(err)
+	}
+	if task, _ := o.LeaseTask(context.Background(), "agent-1"); task != nil {
+		t.Errorf("expected cancelled task not to be leased, got %+v", task)
+	}
+}
+
+func TestCalculateWait(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		target   string
+		prefer   string
+		agent    bool
+		timeout  time.Duration
+		expected int
+	}{
+		{name: "Without wait", target: "/api/v1/calculate", expected: http.StatusCreated},
+		{name: "Result before timeout", target: "/api/v1/calculate?wait=5s", agent: true, expected: http.StatusOK},
+		{name: "Prefer header result", target: "/api/v1/calculate", prefer: "respond-async, wait=5", agent: true, expected: http.StatusOK},
+		{name: "Timeout", target: "/api/v1/calculate?wait=5", timeout: 5 * time.Second, expected: http.StatusAccepted},
+		{name: "Prefer header timeout", target: "/api/v1/calculate", prefer: "wait=3", timeout: 3 * time.Second, expected: http.StatusAccepted},
+		{name: "Wait is limited", target: "/api/v1/calculate?wait=10m", timeout: maxWait, expected: http.StatusAccepted},
+		{name: "Invalid wait", target: "/api/v1/calculate?wait=soon", expected: http.StatusUnprocessableEntity},
+		{name: "Negative wait", target: "/api/v1/calculate?wait=-1s", expected: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := clock.NewFake(start)
+			o := NewOrchestrator(WithClock(fake))
+			if tt.agent {
+				stop := make(chan struct{})
+				defer close(stop)
+				go fakeAgent(o, stop)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(`{"expression": "2*3"}`))
+			if tt.prefer != "" {
+				req.Header.Set("Prefer", tt.prefer)
+			}
+			rec := httptest.NewRecorder()
+			done := make(chan struct{})
+			go func() {
+				o.calculateHandler(rec, req)
+				close(done)
+			}()
+
+			if tt.timeout > 0 {
+				deadline, ok := fake.Next()
+				for !ok {
+					time.Sleep(time.Millisecond)
+					deadline, ok = fake.Next()
+				}
+				if want := start.Add(tt.timeout); !deadline.Equal(want) {
+					t.Fatalf("expected timeout at %v, got %v", want, deadline)
+				}
+				fake.Advance(tt.timeout - time.Millisecond)
+				select {
+				case <-done:
+					t.Fatalf("expected handler to wait until timeout, got %v", rec.Code)
+				case <-time.After(10 * time.Millisecond):
+				}
+				fake.Advance(time.Millisecond)
+			}
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("handler didn't return")
+			}
+			if rec.Code != tt.expected {
+				t.Fatalf("expected %v, got %v: %v", tt.expected, rec.Code, rec.Body)
+			}
+
+			var body struct {
+				ID         string      `json:"id"`
+				Expression *Expression `json:"expression"`
+			}
+			if tt.expected >= http.StatusBadRequest {
+				return
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case tt.expected == http.StatusOK:
+				if body.Expression == nil || body.Expression.Status != StatusCompleted || body.Expression.Result != 6 {
+					t.Errorf("expected completed expression with 6, got %+v", body.Expression)
+				}
+			case body.ID == "":
+				t.Errorf("expected ID of expression, got %v", rec.Body)
+			}
+		})
+	}
+}
+
+func TestOperationTimesOverrideEnv(t *testing.T) {
+	t.Setenv("TIME_MULTIPLICATION_MS", "5000")
+	o := NewOrchestrator(WithOperationTimes(map[string]time.Duration{"*": 100 * time.Millisecond}))
+
+	if err := o.loadConfig(""); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.reloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if ms := o.operationTime("*"); ms != 100 {
+		t.Errorf("expected 100ms from options, got %v", ms)
+	}
+}
+
+func TestShutdownDrain(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	o := NewOrchestrator(WithClock(fake))
+	stopEval := o.Start()
+
+	o.Submit(context.Background(), "user", ExpressionRequest{Expression: "2+2"})
+	o.Submit(context.Background(), "user", ExpressionRequest{Expression: "3+3"})
+	for o.queue.len() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	task, _ := o.LeaseTask(context.Background(), "agent-1")
+	if task == nil {
+		t.Fatal("expected task")
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		o.shutdown(&http.Server{}, nil, stopEval)
+		close(stopped)
+	}()
+
+	// finished expression wakes up drain, but the second one is still running
+	o.CompleteTask(context.Background(), "agent-1", TaskResult{ID: task.ID, ExpressionID: task.ExpressionID, Result: 4})
+	select {
+	case <-stopped:
+		t.Fatal("expected shutdown to wait for unfinished expression")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// drain ends by timeout of injected clock
+	fake.Advance(o.shutdownTimeout)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("expected shutdown to stop after timeout")
+	}
+}
+
+func TestAuditLogLimit(t *testing.T) {
+	o := NewOrchestrator()
+	for i := 0; i < maxAuditEntries+10; i++ {
+		cfg := o.Config()
+		cfg.MaxRetries = i
+		if err := o.SetConfig(cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries := o.auditLog.list()
+	if len(entries) != maxAuditEntries {
+		t.Fatalf("expected %v entries, got %v", maxAuditEntries, len(entries))
+	}
+	if entries[0].After.MaxRetries != 10 || entries[len(entries)-1].After.MaxRetries != maxAuditEntries+9 {
+		t.Errorf("expected the oldest entries to be dropped, got %v..%v", entries[0].After.MaxRetries, entries[len(entries)-1].After.MaxRetries)
+	}
+}
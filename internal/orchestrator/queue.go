@@ -0,0 +1,180 @@
+package orchestrator
+
+import (
+	"sync"
+	"time"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/clock"
+)
+
+// Queue - order in which tasks are given to agents. Orchestrator calls it under its own lock, so queue doesn't need
+// to be safe for concurrent use. Backlog limit and counters are kept by orchestrator. Default queue is NewScheduler
+type Queue interface {
+	Push(task *Task)
+	// Pop - takes next task. Returns false if queue is empty
+	Pop() (*Task, bool)
+	Len() int
+	// Depths - amount of queued tasks for every priority
+	Depths() map[string]int
+	// Snapshot - queued tasks in debug view
+	Snapshot() []QueuedTask
+}
+
+// weightedQueue - queue which supports scheduling weights of owners
+type weightedQueue interface {
+	SetWeight(ownerID string, weight float64)
+}
+
+// removableQueue - queue which can drop task before it is popped. Without it cancelled tasks stay in queue,
+// count in its depth and are skipped only when popped
+type removableQueue interface {
+	Remove(task *Task) bool
+}
+
+// taskQueue - queue with admission control, counters and signal for waiting consumers
+type taskQueue struct {
+	mu       sync.Mutex
+	queue    Queue
+	clock    clock.Clock
+	limit    int
+	enqueued uint64
+	dequeued uint64
+	rejected uint64
+	signal   chan struct{}
+}
+
+func newTaskQueue(queue Queue, c clock.Clock) *taskQueue {
+	return &taskQueue{
+		queue:  queue,
+		clock:  c,
+		limit:  10000,
+		signal: make(chan struct{}, 1),
+	}
+}
+
+// push - adds task to queue and wakes up one waiting consumer
+func (q *taskQueue) push(task *Task) {
+	q.mu.Lock()
+	task.queuedAt = q.clock.Now()
+	q.queue.Push(task)
+	q.enqueued++
+	q.mu.Unlock()
+
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+// pop - takes next task. Returns false if queue is empty
+func (q *taskQueue) pop() (*Task, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	task, ok := q.queue.Pop()
+	if ok {
+		q.dequeued++
+	}
+	return task, ok
+}
+
+// remove - drops finished task from queue, so it doesn't count in depth and admission. Does nothing if task
+// isn't queued or queue can't remove tasks
+func (q *taskQueue) remove(task *Task) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if removable, ok := q.queue.(removableQueue); ok {
+		removable.Remove(task)
+	}
+}
+
+// ready - channel which receives value after push. Consumers must pop until queue is empty before waiting on it
+func (q *taskQueue) ready() <-chan struct{} {
+	return q.signal
+}
+
+// admit - admission control for new expressions. Queue itself is unbounded, so tasks of accepted expressions
+// are never blocked, but new expressions are rejected while backlog is over limit
+func (q *taskQueue) admit() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.limit > 0 && q.queue.Len() >= q.limit {
+		q.rejected++
+		return false
+	}
+	return true
+}
+
+// len - amount of queued tasks
+func (q *taskQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.queue.Len()
+}
+
+// setLimit - changes backlog limit. Zero means no limit
+func (q *taskQueue) setLimit(limit int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.limit = limit
+}
+
+// stats - queue depth gauge and counters
+func (q *taskQueue) stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	depth := q.queue.Len()
+	return QueueStats{
+		Accepting: q.limit <= 0 || depth < q.limit,
+		Depth:     depth,
+		Limit:     q.limit,
+		Enqueued:  q.enqueued,
+		Dequeued:  q.dequeued,
+		Rejected:  q.rejected,
+		Priority:  q.queue.Depths(),
+	}
+}
+
+// depths - amount of queued tasks for every priority
+func (q *taskQueue) depths() map[string]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.queue.Depths()
+}
+
+// snapshot - queued tasks in debug view
+func (q *taskQueue) snapshot() []QueuedTask {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.queue.Snapshot()
+}
+
+// setWeight - changes share of owner in scheduling. Returns false if queue has no weights
+func (q *taskQueue) setWeight(ownerID string, weight float64) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	weighted, ok := q.queue.(weightedQueue)
+	if ok {
+		weighted.SetWeight(ownerID, weight)
+	}
+	return ok
+}
+
+// Priority - priority of expression of task
+func (t *Task) Priority() string {
+	return t.priority
+}
+
+// OwnerID - owner of expression of task
+func (t *Task) OwnerID() string {
+	return t.ownerID
+}
+
+// QueuedAt - time when task was pushed to queue last time
+func (t *Task) QueuedAt() time.Time {
+	return t.queuedAt
+}
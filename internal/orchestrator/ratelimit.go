@@ -0,0 +1,131 @@
+package orchestrator
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// bucket - token bucket, refilled with rate tokens per second up to burst
+type bucket struct {
+	tokens   float64
+	rate     float64
+	burst    float64
+	lastSeen time.Time
+}
+
+// take - takes one token. If there is no token, returns time after which it appears
+func (b *bucket) take(now time.Time) (bool, time.Duration) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.lastSeen).Seconds()*b.rate)
+	b.lastSeen = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	return false, wait
+}
+
+// rateLimiter - token buckets by key
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: make(map[string]*bucket)}
+}
+
+// allow - takes token from bucket of key. Rate <= 0 means no limit
+func (l *rateLimiter) allow(key string, rate float64, burst int, now time.Time) (bool, time.Duration) {
+	if rate <= 0 {
+		return true, 0
+	}
+	if burst < 1 {
+		burst = 1
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), lastSeen: now}
+		l.buckets[key] = b
+	}
+	b.rate = rate
+	b.burst = float64(burst)
+
+	return b.take(now)
+}
+
+// sweep - removes buckets that were not used for a long time, they are full anyway
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) > 10*time.Minute {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// rateLimitConfig - default limits in requests per second
+type rateLimitConfig struct {
+	keyRate  float64
+	keyBurst int
+	ipRate   float64
+	ipBurst  int
+}
+
+// rateLimitMiddleware - limits requests per caller (API key or user) and per IP. Returns 429 with Retry-After
+func (o *Orchestrator) rateLimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		now := o.clock.Now()
+
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		if ok, wait := o.limiter.allow("ip:"+ip, o.rateLimits.ipRate, o.rateLimits.ipBurst, now); !ok {
+			tooManyRequests(w, wait)
+			return
+		}
+
+		if principal := principalFromContext(r.Context()); principal != nil {
+			key, rate, burst := "user:"+principal.OwnerID, o.rateLimits.keyRate, o.rateLimits.keyBurst
+			if principal.KeyID != "" {
+				key = "key:" + principal.KeyID
+			}
+			if principal.RateLimit > 0 {
+				rate, burst = principal.RateLimit, principal.Burst
+			}
+			if ok, wait := o.limiter.allow(key, rate, burst, now); !ok {
+				tooManyRequests(w, wait)
+				return
+			}
+		}
+
+		next(w, r)
+	}
+}
+
+// tooManyRequests - writes 429 with amount of seconds to wait
+func tooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, "Too many requests", http.StatusTooManyRequests)
+}
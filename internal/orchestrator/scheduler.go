@@ -0,0 +1,262 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	PriorityLow    = "low"
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+)
+
+// priorityWeights - share of dispatched tasks for every priority level
+var priorityWeights = map[string]float64{
+	PriorityLow:    1,
+	PriorityNormal: 2,
+	PriorityHigh:   4,
+}
+
+// validPriority - checks if priority is known
+func validPriority(priority string) bool {
+	_, ok := priorityWeights[priority]
+	return ok
+}
+
+type flowKey struct {
+	priority string
+	ownerID  string
+}
+
+// flow - FIFO queue of tasks of one owner with one priority
+type flow struct {
+	key   flowKey
+	tasks []*Task
+	pass  float64
+	seq   uint64
+}
+
+// scheduler - weighted fair queue of tasks. Every (priority, owner) pair is a flow with weight
+// priorityWeight * ownerWeight, and the flow with the smallest pass gets the next task dispatched
+type scheduler struct {
+	flows       map[flowKey]*flow
+	weights     map[string]float64
+	virtualTime float64
+	flowSeq     uint64
+	depth       map[string]int
+	total       int
+}
+
+type QueueStats struct {
+	Accepting bool           `json:"accepting"`
+	Depth     int            `json:"depth"`
+	Limit     int            `json:"limit"`
+	Enqueued  uint64         `json:"enqueued"`
+	Dequeued  uint64         `json:"dequeued"`
+	Rejected  uint64         `json:"rejected"`
+	Priority  map[string]int `json:"priority"`
+}
+
+// NewScheduler - weighted fair queue used by orchestrator by default
+func NewScheduler() Queue {
+	return newScheduler()
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{
+		flows:   make(map[flowKey]*flow),
+		weights: make(map[string]float64),
+		depth:   make(map[string]int),
+	}
+}
+
+// weight - weight of flow
+func (s *scheduler) weight(key flowKey) float64 {
+	weight, ok := s.weights[key.ownerID]
+	if !ok {
+		weight = 1
+	}
+	return priorityWeights[key.priority] * weight
+}
+
+// Push - adds task to the end of flow of its owner and priority
+func (s *scheduler) Push(task *Task) {
+	key := flowKey{priority: task.priority, ownerID: task.ownerID}
+	f, ok := s.flows[key]
+	if !ok {
+		// new flow starts from current virtual time, so idle owners don't save up credit
+		s.flowSeq++
+		f = &flow{key: key, pass: s.virtualTime, seq: s.flowSeq}
+		s.flows[key] = f
+	}
+	f.tasks = append(f.tasks, task)
+	s.depth[key.priority]++
+	s.total++
+}
+
+// before - order of flows: smaller pass, then higher priority, then older flow. Ties never depend on map order
+func (f *flow) before(other *flow) bool {
+	if f.pass != other.pass {
+		return f.pass < other.pass
+	}
+	if priorityWeights[f.key.priority] != priorityWeights[other.key.priority] {
+		return priorityWeights[f.key.priority] > priorityWeights[other.key.priority]
+	}
+	return f.seq < other.seq
+}
+
+// Pop - takes next task by weighted fair order. Returns false if queue is empty
+func (s *scheduler) Pop() (*Task, bool) {
+	var next *flow
+	for _, f := range s.flows {
+		if next == nil || f.before(next) {
+			next = f
+		}
+	}
+	if next == nil {
+		return nil, false
+	}
+
+	task := next.tasks[0]
+	next.tasks[0] = nil
+	next.tasks = next.tasks[1:]
+	s.depth[next.key.priority]--
+	s.total--
+
+	s.virtualTime = next.pass
+	next.pass += 1 / s.weight(next.key)
+	if len(next.tasks) == 0 {
+		delete(s.flows, next.key)
+	}
+
+	return task, true
+}
+
+// Remove - drops task from its flow. Returns false if task isn't queued
+func (s *scheduler) Remove(task *Task) bool {
+	key := flowKey{priority: task.priority, ownerID: task.ownerID}
+	f, ok := s.flows[key]
+	if !ok {
+		return false
+	}
+
+	for i, queued := range f.tasks {
+		if queued != task {
+			continue
+		}
+		f.tasks = append(f.tasks[:i], f.tasks[i+1:]...)
+		s.depth[key.priority]--
+		s.total--
+		if len(f.tasks) == 0 {
+			delete(s.flows, key)
+		}
+		return true
+	}
+	return false
+}
+
+// Len - amount of queued tasks
+func (s *scheduler) Len() int {
+	return s.total
+}
+
+// SetWeight - changes share of owner in scheduling
+func (s *scheduler) SetWeight(ownerID string, weight float64) {
+	s.weights[ownerID] = weight
+}
+
+// Depths - amount of queued tasks for every priority
+func (s *scheduler) Depths() map[string]int {
+	depths := make(map[string]int, len(priorityWeights))
+	for priority := range priorityWeights {
+		depths[priority] = s.depth[priority]
+	}
+	return depths
+}
+
+// getStatusHandler - public status of orchestrator, so clients can see backlog before submitting
+func (o *Orchestrator) getStatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"queue": o.queue.stats()}); err != nil {
+		http.Error(w, "Error encoding status", http.StatusInternalServerError)
+		return
+	}
+}
+
+// backpressureMiddleware - rejects new expressions with 503 while task backlog is over limit
+func (o *Orchestrator) backpressureMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !o.queue.admit() {
+			w.Header().Set("Retry-After", strconv.Itoa(o.getConfig().QueueRetryAfterS))
+			http.Error(w, "Task queue is full", http.StatusServiceUnavailable)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// getQueueHandler - returns queue depth for every priority
+func (o *Orchestrator) getQueueHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"queue": o.queue.depths()}); err != nil {
+		http.Error(w, "Error encoding queue", http.StatusInternalServerError)
+		return
+	}
+}
+
+// setWeightHandler - sets scheduling weight of owner
+func (o *Orchestrator) setWeightHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Weight float64 `json:"weight"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Weight <= 0 {
+		http.Error(w, "Invalid request body", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if !o.queue.setWeight(mux.Vars(r)["id"], req.Weight) {
+		http.Error(w, "Queue doesn't support weights", http.StatusNotImplemented)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// QueuedTask - task in debug view of queue
+type QueuedTask struct {
+	TaskID       string    `json:"task_id"`
+	ExpressionID string    `json:"expression_id"`
+	Operation    string    `json:"operation"`
+	Priority     string    `json:"priority"`
+	OwnerID      string    `json:"owner_id"`
+	QueuedAt     time.Time `json:"queued_at"`
+}
+
+// Snapshot - queued tasks of all flows, oldest first
+func (s *scheduler) Snapshot() []QueuedTask {
+	list := make([]QueuedTask, 0, s.total)
+	for _, f := range s.flows {
+		for _, task := range f.tasks {
+			list = append(list, QueuedTask{
+				TaskID:       task.ID,
+				ExpressionID: task.ExpressionID,
+				Operation:    task.Operation,
+				Priority:     f.key.priority,
+				OwnerID:      f.key.ownerID,
+				QueuedAt:     task.queuedAt,
+			})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].QueuedAt.Before(list[j].QueuedAt) })
+	return list
+}
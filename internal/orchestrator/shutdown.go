@@ -0,0 +1,167 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg"
+)
+
+// persistedExpression - unfinished expression saved at shutdown to be calculated again after restart
+type persistedExpression struct {
+	ID       string `json:"id"`
+	OwnerID  string `json:"owner_id"`
+	Expr     string `json:"expression"`
+	NoCache  bool   `json:"no_cache"`
+	Optimize bool   `json:"optimize"`
+	Priority string `json:"priority"`
+}
+
+// loadShutdownEnv - loads drain timeout and path of state file
+func (o *Orchestrator) loadShutdownEnv() {
+	o.stateFile = pkg.GetEnvWithDefault("STATE_FILE", "")
+	o.shutdownTimeout = time.Duration(pkg.GetEnvIntWithDefault("SHUTDOWN_TIMEOUT_MS", 30000)) * time.Millisecond
+}
+
+// drainingMiddleware - rejects new expressions while orchestrator is shutting down
+func (o *Orchestrator) drainingMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if o.draining.Load() {
+			http.Error(w, "Orchestrator is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// shutdown - stops accepting expressions, waits until agents finish in-flight ones, saves the rest and closes servers
+func (o *Orchestrator) shutdown(server, internalServer *http.Server, stopEval func()) {
+	slog.Info("Shutting down: not accepting new expressions")
+	o.draining.Store(true)
+
+	timeout := make(chan struct{})
+	timer := o.clock.AfterFunc(o.shutdownTimeout, func() { close(timeout) })
+drain:
+	for o.unfinishedExpressions() > 0 {
+		select {
+		case <-o.finished:
+		case <-timeout:
+			break drain
+		}
+	}
+	timer.Stop()
+
+	// state is saved before evaluation stops, because interrupted expressions get status error
+	if left := o.unfinishedExpressions(); left > 0 {
+		slog.Warn("Shutting down with unfinished expressions", "count", left)
+		if err := o.saveState(o.stateFile); err != nil {
+			slog.Error("Error saving state", "error", err)
+		}
+	}
+
+	stopEval()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if internalServer != nil {
+		if err := internalServer.Shutdown(ctx); err != nil {
+			slog.Error("Error shutting down internal server", "error", err)
+		}
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("Error shutting down server", "error", err)
+	}
+	if err := o.tracer.Close(); err != nil {
+		slog.Error("Error closing trace exporter", "error", err)
+	}
+	slog.Info("Server stopped")
+}
+
+// unfinishedExpressions - amount of expressions which are not in terminal status
+func (o *Orchestrator) unfinishedExpressions() int {
+	count := 0
+	for _, expr := range o.store.List() {
+		expr.mu.Lock()
+		if !isTerminal(expr.Status) {
+			count++
+		}
+		expr.mu.Unlock()
+	}
+	return count
+}
+
+// saveState - writes unfinished expressions to file, so they are calculated after restart
+func (o *Orchestrator) saveState(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	var state []persistedExpression
+	for _, expr := range o.store.List() {
+		expr.mu.Lock()
+		if !isTerminal(expr.Status) {
+			state = append(state, persistedExpression{
+				ID:       expr.ID,
+				OwnerID:  expr.OwnerID,
+				Expr:     expr.Expr,
+				NoCache:  expr.noCache,
+				Optimize: expr.optimize,
+				Priority: expr.priority,
+			})
+		}
+		expr.mu.Unlock()
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	slog.Info("Saving unfinished expressions", "count", len(state), "path", path)
+	return os.WriteFile(path, data, 0o600)
+}
+
+// restoreState - calculates again expressions saved at previous shutdown
+func (o *Orchestrator) restoreState(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var state []persistedExpression
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	for _, saved := range state {
+		expr := &Expression{
+			ID:       saved.ID,
+			OwnerID:  saved.OwnerID,
+			Expr:     saved.Expr,
+			Status:   StatusQueued,
+			done:     make(chan struct{}),
+			noCache:  saved.NoCache,
+			optimize: saved.Optimize,
+			priority: saved.Priority,
+		}
+
+		o.addExpression(expr)
+
+		go o.processExpression(o.evaluationContext(), expr)
+	}
+	slog.Info("Restored unfinished expressions", "count", len(state), "path", path)
+
+	return os.Remove(path)
+}
@@ -0,0 +1,108 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	StatusQueued     = "queued"
+	StatusProcessing = "processing"
+	StatusCompleted  = "completed"
+	StatusError      = "error"
+	StatusCancelled  = "cancelled"
+)
+
+var (
+	ErrIllegalTransition   = errors.New("illegal status transition")
+	ErrExpressionCancelled = errors.New("expression cancelled")
+)
+
+// transitions - allowed expression status changes. Terminal statuses have no outgoing transitions
+var transitions = map[string][]string{
+	StatusQueued:     {StatusProcessing, StatusError, StatusCancelled},
+	StatusProcessing: {StatusCompleted, StatusError, StatusCancelled},
+}
+
+// isTerminal - checks if expression can't change status anymore
+func isTerminal(status string) bool {
+	return len(transitions[status]) == 0
+}
+
+// transition - the only place where expression status changes. Must be called with e.mu held
+func (e *Expression) transition(to string) error {
+	for _, allowed := range transitions[e.Status] {
+		if allowed == to {
+			e.Status = to
+			if isTerminal(to) {
+				if e.onFinish != nil {
+					e.onFinish(to)
+				}
+				e.markDone()
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s -> %s", ErrIllegalTransition, e.Status, to)
+}
+
+// start - moves expression from queue to processing
+func (e *Expression) start() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.transition(StatusProcessing)
+}
+
+// complete - saves result of root task and finishes expression
+func (e *Expression) complete(result float64) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.transition(StatusCompleted); err != nil {
+		return err
+	}
+	e.Result = result
+	return nil
+}
+
+// fail - finishes expression with error
+func (e *Expression) fail() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.transition(StatusError)
+}
+
+// cancel - finishes expression without result, stops its evaluation and drops its tasks from queue
+func (e *Expression) cancel() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.transition(StatusCancelled); err != nil {
+		return err
+	}
+	if e.stop != nil {
+		e.stop()
+	}
+	for _, task := range e.Tasks {
+		task.fail(ErrExpressionCancelled)
+	}
+	return nil
+}
+
+// cancelled - checks if expression was cancelled by user
+func (e *Expression) cancelled() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.Status == StatusCancelled
+}
+
+// markDone - notifies waiters that expression is finished. Must be called with e.mu held
+func (e *Expression) markDone() {
+	if e.done == nil {
+		return
+	}
+	select {
+	case <-e.done:
+	default:
+		close(e.done)
+	}
+}
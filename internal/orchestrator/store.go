@@ -0,0 +1,46 @@
+package orchestrator
+
+import "sync"
+
+// Store - keeps expressions of orchestrator. Must be safe for concurrent use. Default store is NewMemoryStore
+type Store interface {
+	Save(expr *Expression)
+	Get(id string) (*Expression, bool)
+	// List - all expressions in any order
+	List() []*Expression
+}
+
+// memoryStore - expressions in map, lost on restart
+type memoryStore struct {
+	mu          sync.Mutex
+	expressions map[string]*Expression
+}
+
+// NewMemoryStore - store which keeps expressions in memory
+func NewMemoryStore() Store {
+	return &memoryStore{expressions: make(map[string]*Expression)}
+}
+
+func (s *memoryStore) Save(expr *Expression) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expressions[expr.ID] = expr
+}
+
+func (s *memoryStore) Get(id string) (*Expression, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expr, ok := s.expressions[id]
+	return expr, ok
+}
+
+func (s *memoryStore) List() []*Expression {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]*Expression, 0, len(s.expressions))
+	for _, expr := range s.expressions {
+		list = append(list, expr)
+	}
+	return list
+}
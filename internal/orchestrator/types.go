@@ -1,6 +1,12 @@
 package orchestrator
 
-import "sync"
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/trace"
+)
 
 type Node struct {
 	Value     float64
@@ -8,25 +14,43 @@ type Node struct {
 	Left      *Node
 	Right     *Node
 	Task      *Task
+
+	once   sync.Once
+	result float64
+	err    error
 }
 
 type ExpressionRequest struct {
 	Expression string `json:"expression"`
+	NoCache    bool   `json:"no_cache"`
+	Optimize   bool   `json:"optimize"`
+	Priority   string `json:"priority"`
 }
 
 type TaskResult struct {
 	ID           string  `json:"id"`
 	Result       float64 `json:"result"`
 	ExpressionID string  `json:"expression_id"`
+	Error        string  `json:"error,omitempty"`
 }
 
 type Expression struct {
-	ID     string  `json:"id"`
-	Expr   string  `json:"expression"`
-	Status string  `json:"status"`
-	Result float64 `json:"result"`
-	Tasks  []*Task `json:"-"`
-	mu     sync.Mutex
+	ID      string  `json:"id"`
+	OwnerID string  `json:"-"`
+	Expr    string  `json:"expression"`
+	Status  string  `json:"status"`
+	Result  float64 `json:"result"`
+	Tasks   []*Task `json:"-"`
+
+	taskByID    map[string]*Task
+	noCache     bool
+	optimize    bool
+	priority    string
+	traceParent trace.SpanContext
+	stop        context.CancelFunc
+	onFinish    func(status string)
+	mu          sync.Mutex
+	done        chan struct{}
 }
 
 type Task struct {
@@ -38,4 +62,48 @@ type Task struct {
 	Result        float64 `json:"result,omitempty"`
 	Status        string  `json:"status"`
 	OperationTime int     `json:"operation_time"`
+
+	done      chan struct{}
+	err       error
+	expr      *Expression
+	attempts  int
+	priority  string
+	ownerID   string
+	createdAt time.Time
+	queuedAt  time.Time
+	traceCtx  trace.SpanContext
+}
+
+type User struct {
+	ID    string `json:"id"`
+	Login string `json:"login"`
+
+	passwordHash []byte
+}
+
+type AuthRequest struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+type APIKey struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Scopes    []string   `json:"scopes"`
+	OwnerID   string     `json:"owner_id"`
+	RateLimit float64    `json:"rate_limit,omitempty"`
+	Burst     int        `json:"burst,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+
+	hash string
+}
+
+type APIKeyRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	OwnerID   string   `json:"owner_id"`
+	RateLimit float64  `json:"rate_limit"`
+	Burst     int      `json:"burst"`
 }
@@ -0,0 +1,174 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const usageHistoryDays = 30
+
+type Usage struct {
+	Date       string `json:"date"`
+	Operations int    `json:"operations"`
+	ComputeMs  int    `json:"compute_ms"`
+}
+
+type Quota struct {
+	Operations int `json:"operations"`
+	ComputeMs  int `json:"compute_ms"`
+}
+
+// usageTracker - counts operations and compute time of every owner per day
+type usageTracker struct {
+	mu           sync.Mutex
+	days         map[string]map[string]*Usage
+	quotas       map[string]Quota
+	defaultQuota Quota
+}
+
+func newUsageTracker() *usageTracker {
+	return &usageTracker{
+		days:   make(map[string]map[string]*Usage),
+		quotas: make(map[string]Quota),
+	}
+}
+
+// day - returns date used as usage period
+func day(now time.Time) string {
+	return now.UTC().Format("2006-01-02")
+}
+
+// record - adds one calculated operation to usage of owner
+func (u *usageTracker) record(ownerID string, computeMs int, now time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	days, ok := u.days[ownerID]
+	if !ok {
+		days = make(map[string]*Usage)
+		u.days[ownerID] = days
+	}
+
+	date := day(now)
+	current, ok := days[date]
+	if !ok {
+		current = &Usage{Date: date}
+		days[date] = current
+
+		oldest := day(now.AddDate(0, 0, -usageHistoryDays))
+		for d := range days {
+			if d < oldest {
+				delete(days, d)
+			}
+		}
+	}
+
+	current.Operations++
+	current.ComputeMs += computeMs
+}
+
+// quota - returns quota of owner. Zero value of field means no limit
+func (u *usageTracker) quota(ownerID string) Quota {
+	if quota, ok := u.quotas[ownerID]; ok {
+		return quota
+	}
+	return u.defaultQuota
+}
+
+// today - returns usage of owner for current day
+func (u *usageTracker) today(ownerID string, now time.Time) Usage {
+	if current, ok := u.days[ownerID][day(now)]; ok {
+		return *current
+	}
+	return Usage{Date: day(now)}
+}
+
+// exceeded - checks if owner has used daily quota
+func (u *usageTracker) exceeded(ownerID string, now time.Time) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	quota := u.quota(ownerID)
+	current := u.today(ownerID, now)
+
+	return (quota.Operations > 0 && current.Operations >= quota.Operations) ||
+		(quota.ComputeMs > 0 && current.ComputeMs >= quota.ComputeMs)
+}
+
+// report - returns usage history, today usage and quota of owner
+func (u *usageTracker) report(ownerID string, now time.Time) map[string]interface{} {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	history := []Usage{}
+	for _, d := range u.days[ownerID] {
+		history = append(history, *d)
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Date < history[j].Date
+	})
+
+	return map[string]interface{}{
+		"today":   u.today(ownerID, now),
+		"quota":   u.quota(ownerID),
+		"history": history,
+	}
+}
+
+// setQuota - sets personal quota of owner
+func (u *usageTracker) setQuota(ownerID string, quota Quota) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.quotas[ownerID] = quota
+}
+
+// untilNextDay - time until usage is reset
+func untilNextDay(now time.Time) time.Duration {
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	return next.Sub(now)
+}
+
+// quotaMiddleware - rejects submissions of owners who used their daily quota
+func (o *Orchestrator) quotaMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		now := o.clock.Now()
+		if o.usage.exceeded(userIDFromContext(r.Context()), now) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(untilNextDay(now).Seconds()))))
+			http.Error(w, "Quota exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// getUsageHandler - returns usage and quota of caller
+func (o *Orchestrator) getUsageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"usage": o.usage.report(userIDFromContext(r.Context()), o.clock.Now())}); err != nil {
+		http.Error(w, "Error encoding usage", http.StatusInternalServerError)
+		return
+	}
+}
+
+// setQuotaHandler - sets personal quota of owner
+func (o *Orchestrator) setQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	var quota Quota
+	if err := json.NewDecoder(r.Body).Decode(&quota); err != nil || quota.Operations < 0 || quota.ComputeMs < 0 {
+		http.Error(w, "Invalid request body", http.StatusUnprocessableEntity)
+		return
+	}
+
+	o.usage.setQuota(mux.Vars(r)["id"], quota)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -188,6 +188,52 @@ func TestIsOperator(t *testing.T) {
 	}
 }
 
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected float64
+		err      error
+	}{
+		{
+			name:     "Precedence",
+			input:    "2+2*2",
+			expected: 6,
+		},
+		{
+			name:     "Parentheses",
+			input:    "(1+2)*3-4/2",
+			expected: 7,
+		},
+		{
+			name:  "Division by zero",
+			input: "1/(2-2)",
+			err:   ErrDivisionByZero,
+		},
+		{
+			name:  "Missing operand",
+			input: "1+",
+			err:   errors.New("invalid expression"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result float64
+			root, err := Parse(tt.input)
+			if err == nil {
+				result, err = root.Evaluate()
+			}
+			if !errorsAreEqual(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
 func errorsAreEqual(err1, err2 error) bool {
 	if err1 == nil && err2 == nil {
 		return true
@@ -0,0 +1,123 @@
+package calc
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var ErrDivisionByZero = errors.New("division by zero")
+
+// Node - node of AST. Leaf has only Value, other nodes have Operation and both operands
+type Node struct {
+	Value     float64
+	Operation string
+	Left      *Node
+	Right     *Node
+}
+
+// Parse - builds AST from expression string
+func Parse(expression string) (*Node, error) {
+	tokens, err := Tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	postfix, err := InfixToPostfix(tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	return BuildTree(postfix)
+}
+
+// BuildTree - builds AST from tokens in postfix
+func BuildTree(postfix []string) (*Node, error) {
+	if len(postfix) == 0 {
+		return nil, errors.New("empty expression")
+	}
+
+	var stack []*Node
+
+	for _, token := range postfix {
+		switch {
+		case IsNumber(token):
+			num, _ := strconv.ParseFloat(token, 64)
+			stack = append(stack, &Node{Value: num})
+		case IsOperator(token):
+			if len(stack) < 2 {
+				return nil, errors.New("invalid expression")
+			}
+			right := stack[len(stack)-1]
+			left := stack[len(stack)-2]
+			stack = stack[:len(stack)-2]
+			stack = append(stack, &Node{Operation: token, Left: left, Right: right})
+		default:
+			return nil, errors.New("invalid token " + token)
+		}
+	}
+
+	if len(stack) != 1 {
+		return nil, errors.New("invalid expression")
+	}
+
+	return stack[0], nil
+}
+
+// Evaluate - calculates AST in current goroutine
+func (n *Node) Evaluate() (float64, error) {
+	if n.Operation == "" {
+		return n.Value, nil
+	}
+
+	left, err := n.Left.Evaluate()
+	if err != nil {
+		return 0, err
+	}
+	right, err := n.Right.Evaluate()
+	if err != nil {
+		return 0, err
+	}
+
+	switch n.Operation {
+	case "+":
+		return left + right, nil
+	case "-":
+		return left - right, nil
+	case "*":
+		return left * right, nil
+	case "/":
+		if right == 0 {
+			return 0, ErrDivisionByZero
+		}
+		return left / right, nil
+	default:
+		return 0, errors.New("unknown operation " + n.Operation)
+	}
+}
+
+// String - expression of AST with every operation in parentheses
+func (n *Node) String() string {
+	if n.Operation == "" {
+		return strconv.FormatFloat(n.Value, 'g', -1, 64)
+	}
+	return "(" + n.Left.String() + n.Operation + n.Right.String() + ")"
+}
+
+// Tree - AST drawn line by line, operands are below their operation
+func (n *Node) Tree() string {
+	var b strings.Builder
+	n.writeTree(&b, "", "")
+	return b.String()
+}
+
+func (n *Node) writeTree(b *strings.Builder, prefix, childPrefix string) {
+	if n.Operation == "" {
+		b.WriteString(prefix + strconv.FormatFloat(n.Value, 'g', -1, 64) + "\n")
+		return
+	}
+
+	b.WriteString(prefix + n.Operation + "\n")
+	n.Left.writeTree(b, childPrefix+"├── ", childPrefix+"│   ")
+	n.Right.writeTree(b, childPrefix+"└── ", childPrefix+"    ")
+}
@@ -0,0 +1,223 @@
+// Package calcgo runs orchestrator and agents inside one process. Agents take tasks directly from orchestrator,
+// without HTTP, so it is suitable for tests and small deployments
+package calcgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/internal/agent"
+	"github.com/AzizovHikmatullo/calc-go_V2/internal/orchestrator"
+)
+
+// Statuses of expression
+const (
+	StatusQueued     = orchestrator.StatusQueued
+	StatusProcessing = orchestrator.StatusProcessing
+	StatusCompleted  = orchestrator.StatusCompleted
+	StatusError      = orchestrator.StatusError
+	StatusCancelled  = orchestrator.StatusCancelled
+)
+
+// owner - owner of expressions submitted through Go API
+const owner = "calcgo"
+
+var (
+	ErrNotFound         = orchestrator.ErrExpressionNotFound
+	ErrQueueFull        = orchestrator.ErrQueueFull
+	ErrInvalidPriority  = orchestrator.ErrInvalidPriority
+	ErrExpressionFailed = errors.New("expression failed")
+	ErrNotStarted       = errors.New("cluster is not started")
+	ErrAlreadyStarted   = errors.New("cluster is already started")
+	ErrStopped          = errors.New("cluster is stopped")
+)
+
+// Options - settings of cluster. Zero values mean defaults
+type Options struct {
+	// Agents - amount of agents, 1 by default
+	Agents int
+	// Workers - workers of every agent, 1 by default
+	Workers int
+	// OperationTimes - how long agent calculates "+", "-", "*" and "/". Missing operations are instant, limit is 1h
+	OperationTimes map[string]time.Duration
+	// PollInterval - delay between requests of idle worker, 10ms by default
+	PollInterval time.Duration
+	// ShutdownTimeout - how long agents finish current tasks after ctx of Start is done, 5s by default
+	ShutdownTimeout time.Duration
+}
+
+// Expression - state of expression
+type Expression struct {
+	ID         string
+	Expression string
+	Status     string
+	Result     float64
+}
+
+// Finished - checks if expression won't change anymore
+func (e *Expression) Finished() bool {
+	return e.Status == StatusCompleted || e.Status == StatusError || e.Status == StatusCancelled
+}
+
+// Cluster - orchestrator with agents in one process. Every cluster has its own state, so several clusters can work together
+type Cluster struct {
+	opts   Options
+	orch   *orchestrator.Orchestrator
+	agents []*agent.Agent
+
+	mu      sync.Mutex
+	started bool
+	// ctx - ctx of Start, cluster doesn't accept expressions after it is done
+	ctx  context.Context
+	done chan struct{}
+}
+
+// NewCluster - creates cluster. Nothing is started until Start
+func NewCluster(opts Options) *Cluster {
+	if opts.Agents <= 0 {
+		opts.Agents = 1
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 10 * time.Millisecond
+	}
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = 5 * time.Second
+	}
+
+	times := make(map[string]time.Duration)
+	for _, op := range []string{"+", "-", "*", "/"} {
+		times[op] = opts.OperationTimes[op]
+	}
+
+	return &Cluster{
+		opts: opts,
+		orch: orchestrator.NewOrchestrator(orchestrator.WithOperationTimes(times)),
+		done: make(chan struct{}),
+	}
+}
+
+// Start - starts agents. Returns at once, cluster works until ctx is done,
+// then agents finish current tasks, unfinished expressions get status error and Done is closed
+func (c *Cluster) Start(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.started {
+		return ErrAlreadyStarted
+	}
+
+	stopEval := c.orch.Start()
+
+	for i := 0; i < c.opts.Agents; i++ {
+		id := fmt.Sprintf("agent-%d", i+1)
+		c.agents = append(c.agents, agent.NewAgent(agent.Config{
+			ID:              id,
+			Workers:         c.opts.Workers,
+			PingTime:        int(c.opts.PollInterval.Milliseconds()),
+			Transport:       &memoryTransport{orch: c.orch, agentID: id},
+			ShutdownTimeout: c.opts.ShutdownTimeout,
+		}))
+	}
+
+	var wg sync.WaitGroup
+	for _, a := range c.agents {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.Run(ctx)
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		stopEval()
+		close(c.done)
+	}()
+
+	c.started = true
+	c.ctx = ctx
+	return nil
+}
+
+// Done - closed when cluster is stopped
+func (c *Cluster) Done() <-chan struct{} {
+	return c.done
+}
+
+// Handler - public REST API of cluster, the same as API of orchestrator. Internal API for agents is not served
+func (c *Cluster) Handler() http.Handler {
+	return c.orch.Handler()
+}
+
+// Submit - starts calculation of expression and returns its ID. Returns ErrStopped after ctx of Start is done
+func (c *Cluster) Submit(ctx context.Context, expression string) (string, error) {
+	if err := c.checkRunning(); err != nil {
+		return "", err
+	}
+	return c.orch.Submit(ctx, owner, orchestrator.ExpressionRequest{Expression: expression})
+}
+
+// Get - returns current state of expression
+func (c *Cluster) Get(id string) (*Expression, error) {
+	expr, err := c.orch.Expression(id)
+	if err != nil {
+		return nil, err
+	}
+	return convert(expr), nil
+}
+
+// Wait - waits until expression is finished
+func (c *Cluster) Wait(ctx context.Context, id string) (*Expression, error) {
+	expr, err := c.orch.Wait(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return convert(expr), nil
+}
+
+// Calculate - submits expression and waits for its result. Failed expression returns ErrExpressionFailed
+func (c *Cluster) Calculate(ctx context.Context, expression string) (float64, error) {
+	id, err := c.Submit(ctx, expression)
+	if err != nil {
+		return 0, err
+	}
+
+	expr, err := c.Wait(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	if expr.Status != StatusCompleted {
+		return 0, fmt.Errorf("%w: %v", ErrExpressionFailed, expr.Status)
+	}
+	return expr.Result, nil
+}
+
+// checkRunning - checks that cluster is started and not stopped yet
+func (c *Cluster) checkRunning() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.started {
+		return ErrNotStarted
+	}
+	if c.ctx.Err() != nil {
+		return ErrStopped
+	}
+	return nil
+}
+
+func convert(expr *orchestrator.Expression) *Expression {
+	return &Expression{
+		ID:         expr.ID,
+		Expression: expr.Expr,
+		Status:     expr.Status,
+		Result:     expr.Result,
+	}
+}
@@ -0,0 +1,106 @@
+package calcgo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestClusters(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	first := NewCluster(Options{Agents: 2, Workers: 2})
+	second := NewCluster(Options{OperationTimes: map[string]time.Duration{"*": 5 * time.Millisecond}})
+	for _, c := range []*Cluster{first, second} {
+		if err := c.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := first.Calculate(ctx, "(1+2)*3-4/2")
+	if err != nil || result != 7 {
+		t.Errorf("expected 7, got %v (%v)", result, err)
+	}
+	result, err = second.Calculate(ctx, "2*3*4")
+	if err != nil || result != 24 {
+		t.Errorf("expected 24, got %v (%v)", result, err)
+	}
+
+	id, err := first.Submit(ctx, "2+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.Get(id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected expression of first cluster to be unknown in second, got %v", err)
+	}
+	if expr, err := first.Wait(ctx, id); err != nil || expr.Status != StatusError {
+		t.Errorf("expected invalid expression to fail, got %+v (%v)", expr, err)
+	}
+
+	cancel()
+	for _, c := range []*Cluster{first, second} {
+		select {
+		case <-c.Done():
+		case <-time.After(time.Second):
+			t.Fatal("cluster was not stopped")
+		}
+	}
+}
+
+func TestSubmitAfterStop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c := NewCluster(Options{OperationTimes: map[string]time.Duration{"*": time.Hour}, ShutdownTimeout: 10 * time.Millisecond})
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := c.Submit(ctx, "2*3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Fatal("cluster was not stopped")
+	}
+
+	if _, err := c.Submit(context.Background(), "1+1"); !errors.Is(err, ErrStopped) {
+		t.Errorf("expected ErrStopped, got %v", err)
+	}
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), time.Second)
+	defer waitCancel()
+	if expr, err := c.Wait(waitCtx, id); err != nil || expr.Status != StatusError {
+		t.Errorf("expected interrupted expression to fail, got %+v (%v)", expr, err)
+	}
+}
+
+func TestDivisionByZero(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := NewCluster(Options{OperationTimes: map[string]time.Duration{"+": time.Millisecond, "/": time.Millisecond}})
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expression := range []string{"1/0", "0/0", "2+1/(1-1)"} {
+		waitCtx, waitCancel := context.WithTimeout(ctx, 5*time.Second)
+		id, err := c.Submit(waitCtx, expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expr, err := c.Wait(waitCtx, id); err != nil || expr.Status != StatusError {
+			t.Errorf("%v: expected expression to fail, got %+v (%v)", expression, expr, err)
+		}
+		waitCancel()
+	}
+
+	if _, err := c.Calculate(ctx, "1/0"); !errors.Is(err, ErrExpressionFailed) {
+		t.Errorf("expected ErrExpressionFailed, got %v", err)
+	}
+}
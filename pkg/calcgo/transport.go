@@ -0,0 +1,50 @@
+package calcgo
+
+import (
+	"context"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/internal/agent"
+	"github.com/AzizovHikmatullo/calc-go_V2/internal/orchestrator"
+)
+
+// memoryTransport - agent takes tasks and sends results by calling orchestrator directly
+type memoryTransport struct {
+	orch    *orchestrator.Orchestrator
+	agentID string
+}
+
+func (t *memoryTransport) FetchTask(ctx context.Context) (*agent.TaskRequest, int64, error) {
+	task, depth := t.orch.LeaseTask(ctx, t.agentID)
+	if task == nil {
+		return nil, int64(depth), nil
+	}
+
+	return &agent.TaskRequest{
+		Task: agent.Task{
+			ID:            task.ID,
+			Arg1:          task.Arg1,
+			Arg2:          task.Arg2,
+			Operation:     task.Operation,
+			OperationTime: task.OperationTime,
+			ExpressionID:  task.ExpressionID,
+		},
+		Parent: task.TraceContext(),
+	}, int64(depth), nil
+}
+
+func (t *memoryTransport) SendResult(ctx context.Context, task agent.Task, result float64) error {
+	return t.orch.CompleteTask(ctx, t.agentID, orchestrator.TaskResult{ID: task.ID, Result: result, ExpressionID: task.ExpressionID})
+}
+
+func (t *memoryTransport) FailTask(ctx context.Context, task agent.Task, err error) error {
+	return t.orch.CompleteTask(ctx, t.agentID, orchestrator.TaskResult{ID: task.ID, ExpressionID: task.ExpressionID, Error: err.Error()})
+}
+
+func (t *memoryTransport) ReleaseTask(ctx context.Context, task agent.Task) error {
+	return t.orch.ReleaseTask(ctx, t.agentID, orchestrator.TaskResult{ID: task.ID, ExpressionID: task.ExpressionID})
+}
+
+func (t *memoryTransport) Heartbeat(ctx context.Context, hb agent.Heartbeat) error {
+	t.orch.RecordHeartbeat(orchestrator.Heartbeat{ID: hb.ID, Workers: hb.Workers, Busy: hb.Busy}, "memory")
+	return nil
+}
@@ -0,0 +1,243 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/calc"
+)
+
+// Statuses of expression
+const (
+	StatusQueued     = "queued"
+	StatusProcessing = "processing"
+	StatusCompleted  = "completed"
+	StatusError      = "error"
+	StatusCancelled  = "cancelled"
+)
+
+// Expression - expression as it is returned by orchestrator
+type Expression struct {
+	ID         string  `json:"id"`
+	Expression string  `json:"expression"`
+	Status     string  `json:"status"`
+	Result     float64 `json:"result"`
+}
+
+// Finished - checks if expression can't change status anymore
+func (e *Expression) Finished() bool {
+	return e.Status == StatusCompleted || e.Status == StatusError || e.Status == StatusCancelled
+}
+
+// Err - ErrExpressionFailed or ErrExpressionCancelled for expressions which did not complete, nil otherwise
+func (e *Expression) Err() error {
+	switch e.Status {
+	case StatusError:
+		return ErrExpressionFailed
+	case StatusCancelled:
+		return ErrExpressionCancelled
+	}
+	return nil
+}
+
+// SubmitOptions - optional parameters of submitted expression
+type SubmitOptions struct {
+	NoCache  bool
+	Optimize bool
+	Priority string
+}
+
+// ExplainNode - node of AST
+type ExplainNode struct {
+	Value     *float64     `json:"value,omitempty"`
+	Operation string       `json:"operation,omitempty"`
+	Left      *ExplainNode `json:"left,omitempty"`
+	Right     *ExplainNode `json:"right,omitempty"`
+}
+
+// Node - converts AST returned by orchestrator to calc.Node, e.g. to draw it with Tree
+func (n *ExplainNode) Node() *calc.Node {
+	if n.Operation == "" {
+		var value float64
+		if n.Value != nil {
+			value = *n.Value
+		}
+		return &calc.Node{Value: value}
+	}
+	return &calc.Node{Operation: n.Operation, Left: n.Left.Node(), Right: n.Right.Node()}
+}
+
+// Optimization - change made by optimizer
+type Optimization struct {
+	Rule   string `json:"rule"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// Explain - AST of expression and its optimizations
+type Explain struct {
+	Expression    string         `json:"expression"`
+	Postfix       []string       `json:"postfix"`
+	Tree          *ExplainNode   `json:"tree"`
+	Optimizations []Optimization `json:"optimizations"`
+	Operations    int            `json:"operations"`
+	Depth         int            `json:"depth"`
+}
+
+// Client - client of orchestrator public API. Token is sent as bearer token, APIKey in X-API-Key header.
+// Methods are safe for concurrent use as long as fields are not changed
+type Client struct {
+	BaseURL    string
+	Token      string
+	APIKey     string
+	HTTPClient *http.Client
+	// Backoff - delays between polls in Wait and Stream, DefaultBackoff if not set
+	Backoff Backoff
+}
+
+// New - creates client for orchestrator at baseURL, e.g. http://localhost:8080
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimRight(baseURL, "/"), HTTPClient: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Login - returns access token of user. Token is not stored in client
+func (c *Client) Login(ctx context.Context, login, password string) (string, error) {
+	req := map[string]string{"login": login, "password": password}
+
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/v1/login", req, &resp); err != nil {
+		return "", err
+	}
+	return resp.Token, nil
+}
+
+// Submit - sends expression for calculation and returns its ID
+func (c *Client) Submit(ctx context.Context, expression string, opts SubmitOptions) (string, error) {
+	req := map[string]interface{}{
+		"expression": expression,
+		"no_cache":   opts.NoCache,
+		"optimize":   opts.Optimize,
+		"priority":   opts.Priority,
+	}
+
+	var resp struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/v1/calculate", req, &resp); err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// Get - returns expression with ID
+func (c *Client) Get(ctx context.Context, id string) (*Expression, error) {
+	var resp struct {
+		Expression *Expression `json:"expression"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/v1/expressions/"+url.PathEscape(id), nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Expression == nil {
+		return nil, fmt.Errorf("%w: no expression", ErrInvalidResponse)
+	}
+	return resp.Expression, nil
+}
+
+// List - returns all expressions of user
+func (c *Client) List(ctx context.Context) ([]Expression, error) {
+	var resp struct {
+		Expressions []Expression `json:"expressions"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/v1/expressions", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Expressions, nil
+}
+
+// Cancel - cancels expression which is not finished yet
+func (c *Client) Cancel(ctx context.Context, id string) (*Expression, error) {
+	var resp struct {
+		Expression *Expression `json:"expression"`
+	}
+	if err := c.do(ctx, http.MethodDelete, "/api/v1/expressions/"+url.PathEscape(id), nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Expression == nil {
+		return nil, fmt.Errorf("%w: no expression", ErrInvalidResponse)
+	}
+	return resp.Expression, nil
+}
+
+// Explain - returns AST of expression without calculating it
+func (c *Client) Explain(ctx context.Context, expression string, optimize bool) (*Explain, error) {
+	req := map[string]interface{}{"expression": expression, "optimize": optimize}
+
+	var resp struct {
+		Explain *Explain `json:"explain"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/v1/explain", req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Explain == nil {
+		return nil, fmt.Errorf("%w: no explain", ErrInvalidResponse)
+	}
+	return resp.Explain, nil
+}
+
+// do - sends request with JSON body and decodes JSON response to out. Status codes 4xx and 5xx are returned as *APIError
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.APIKey != "" {
+		req.Header.Set("X-API-Key", c.APIKey)
+	} else if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return newAPIError(resp, body)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+	return nil
+}
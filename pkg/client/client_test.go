@@ -0,0 +1,246 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testBackoff = Backoff{Initial: time.Millisecond, Max: 5 * time.Millisecond, Multiplier: 2}
+
+func TestSubmit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/calculate" {
+			t.Errorf("unexpected request %v %v", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("expected bearer token, got %q", got)
+		}
+
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req["expression"] != "2+2" || req["priority"] != "high" {
+			t.Errorf("unexpected body %v", req)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"id": "1"})
+	}))
+	defer server.Close()
+
+	c := New(server.URL)
+	c.Token = "secret"
+	id, err := c.Submit(context.Background(), "2+2", SubmitOptions{Priority: "high"})
+	if err != nil || id != "1" {
+		t.Errorf("expected ID 1, got %q (%v)", id, err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		code       int
+		message    string
+		retryAfter string
+		expected   error
+		temporary  bool
+	}{
+		{name: "Invalid token", code: http.StatusUnauthorized, message: "Invalid token", expected: ErrUnauthorized},
+		{name: "Missing scope", code: http.StatusForbidden, message: "Forbidden", expected: ErrForbidden},
+		{name: "Unknown expression", code: http.StatusNotFound, message: "Expression not found", expected: ErrNotFound},
+		{name: "Already finished", code: http.StatusConflict, message: "Expression is already finished", expected: ErrConflict},
+		{name: "Invalid priority", code: http.StatusUnprocessableEntity, message: "Invalid priority", expected: ErrInvalidRequest},
+		{name: "Rate limit", code: http.StatusTooManyRequests, message: "Too many requests", retryAfter: "2", expected: ErrRateLimited, temporary: true},
+		{name: "Quota", code: http.StatusTooManyRequests, message: "Quota exceeded", retryAfter: "3600", expected: ErrQuotaExceeded},
+		{name: "Queue full", code: http.StatusServiceUnavailable, message: "Task queue is full", retryAfter: "1", expected: ErrUnavailable, temporary: true},
+		{name: "Internal error", code: http.StatusInternalServerError, message: "Error encoding expression", expected: ErrServer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Request-ID", "req-1")
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				http.Error(w, tt.message, tt.code)
+			}))
+			defer server.Close()
+
+			_, err := New(server.URL).Get(context.Background(), "1")
+			if !errors.Is(err, tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, err)
+			}
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("expected APIError, got %T", err)
+			}
+			if apiErr.Message != tt.message || apiErr.RequestID != "req-1" {
+				t.Errorf("unexpected error fields %+v", apiErr)
+			}
+			if apiErr.Temporary() != tt.temporary {
+				t.Errorf("expected temporary %v", tt.temporary)
+			}
+			if tt.retryAfter == "2" && apiErr.RetryAfter != 2*time.Second {
+				t.Errorf("expected retry after 2s, got %v", apiErr.RetryAfter)
+			}
+		})
+	}
+}
+
+// statusServer - serves expression "1" with next status from list on every request. Empty status means 503
+func statusServer(t *testing.T, statuses ...string) (*httptest.Server, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&calls, 1)) - 1
+		if n >= len(statuses) {
+			n = len(statuses) - 1
+		}
+		if statuses[n] == "" {
+			http.Error(w, "Orchestrator is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"expression": Expression{ID: "1", Expression: "2+2", Status: statuses[n], Result: 4},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestWait(t *testing.T) {
+	server, calls := statusServer(t, StatusQueued, "", StatusProcessing, StatusProcessing, StatusCompleted)
+
+	c := New(server.URL)
+	c.Backoff = testBackoff
+	expr, err := c.Wait(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expr.Status != StatusCompleted || expr.Result != 4 {
+		t.Errorf("expected completed with 4, got %+v", expr)
+	}
+	if got := atomic.LoadInt32(calls); got != 5 {
+		t.Errorf("expected 5 polls, got %v", got)
+	}
+}
+
+func TestWaitStopsOnContext(t *testing.T) {
+	server, _ := statusServer(t, StatusProcessing)
+
+	c := New(server.URL)
+	c.Backoff = testBackoff
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := c.Wait(ctx, "1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestCalculateFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			json.NewEncoder(w).Encode(map[string]string{"id": "1"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"expression": Expression{ID: "1", Expression: "1/0", Status: StatusError}})
+	}))
+	defer server.Close()
+
+	expr, err := New(server.URL).Calculate(context.Background(), "1/0", SubmitOptions{})
+	if !errors.Is(err, ErrExpressionFailed) || expr == nil || expr.ID != "1" {
+		t.Errorf("expected failed expression, got %+v (%v)", expr, err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	server, _ := statusServer(t, StatusQueued, StatusQueued, StatusProcessing, "", StatusProcessing, StatusCompleted)
+
+	c := New(server.URL)
+	c.Backoff = testBackoff
+
+	var statuses []string
+	for update := range c.Stream(context.Background(), "1") {
+		if update.Err != nil {
+			t.Fatalf("unexpected error: %v", update.Err)
+		}
+		statuses = append(statuses, update.Expression.Status)
+	}
+
+	expected := []string{StatusQueued, StatusProcessing, StatusCompleted}
+	if len(statuses) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, statuses)
+	}
+	for i := range expected {
+		if statuses[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, statuses)
+		}
+	}
+}
+
+func TestStreamNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Expression not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	var updates []Update
+	for update := range New(server.URL).Stream(context.Background(), "1") {
+		updates = append(updates, update)
+	}
+
+	if len(updates) != 1 || updates[0].ID != "1" || !errors.Is(updates[0].Err, ErrNotFound) {
+		t.Errorf("expected one not found update, got %+v", updates)
+	}
+}
+
+func TestWaitInvalidResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "HTML page", body: "<html>Hello</html>"},
+		{name: "Empty body", body: ""},
+		{name: "No expression", body: `{"id": "1"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			c := New(server.URL)
+			c.Backoff = testBackoff
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			if _, err := c.Wait(ctx, "1"); !errors.Is(err, ErrInvalidResponse) {
+				t.Errorf("expected invalid response, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+
+	_, unreachable := New(server.URL).Get(context.Background(), "1")
+	_, badURL := New("ftp://localhost").Get(context.Background(), "1")
+
+	if !retryable(context.Background(), unreachable) {
+		t.Errorf("expected network error to be retried: %v", unreachable)
+	}
+	if retryable(context.Background(), badURL) {
+		t.Errorf("expected wrong URL not to be retried: %v", badURL)
+	}
+}
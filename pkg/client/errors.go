@@ -0,0 +1,89 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors which APIError matches with errors.Is, depending on status code and message of response
+var (
+	ErrUnauthorized   = errors.New("unauthorized")
+	ErrForbidden      = errors.New("forbidden")
+	ErrNotFound       = errors.New("not found")
+	ErrConflict       = errors.New("conflict")
+	ErrInvalidRequest = errors.New("invalid request")
+	ErrRateLimited    = errors.New("rate limited")
+	ErrQuotaExceeded  = errors.New("quota exceeded")
+	ErrUnavailable    = errors.New("service unavailable")
+	ErrServer         = errors.New("server error")
+)
+
+// ErrInvalidResponse - response with status 2xx which is not JSON of orchestrator, e.g. when BaseURL is wrong
+var ErrInvalidResponse = errors.New("invalid response")
+
+// Errors of finished expressions, returned by Expression.Err
+var (
+	ErrExpressionFailed    = errors.New("expression failed")
+	ErrExpressionCancelled = errors.New("expression cancelled")
+)
+
+// APIError - response of orchestrator with 4xx or 5xx status code
+type APIError struct {
+	StatusCode int
+	Message    string
+	RequestID  string
+	// RetryAfter - how long server asked to wait before next request, zero if it didn't
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("orchestrator returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Unwrap - one of Err* errors of package, nil for unknown status code
+func (e *APIError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusForbidden:
+		return ErrForbidden
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusConflict:
+		return ErrConflict
+	case e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnprocessableEntity:
+		return ErrInvalidRequest
+	case e.StatusCode == http.StatusTooManyRequests && e.Message == "Quota exceeded":
+		return ErrQuotaExceeded
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.StatusCode == http.StatusServiceUnavailable:
+		return ErrUnavailable
+	case e.StatusCode >= http.StatusInternalServerError:
+		return ErrServer
+	}
+	return nil
+}
+
+// Temporary - checks if the same request can succeed later: rate limit, full queue or restart of orchestrator.
+// Exceeded daily quota is not temporary
+func (e *APIError) Temporary() bool {
+	return errors.Is(e, ErrRateLimited) || errors.Is(e, ErrUnavailable)
+}
+
+// newAPIError - reads error from response. Server writes message as plain text
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	err := &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    strings.TrimSpace(string(body)),
+		RequestID:  resp.Header.Get("X-Request-ID"),
+	}
+	if seconds, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil && seconds > 0 {
+		err.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return err
+}
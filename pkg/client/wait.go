@@ -0,0 +1,201 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"time"
+)
+
+// Backoff - delays between polls of expression status. Every poll without changes multiplies delay up to Max
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+}
+
+// DefaultBackoff - backoff used when Client.Backoff is not set
+var DefaultBackoff = Backoff{Initial: 100 * time.Millisecond, Max: 5 * time.Second, Multiplier: 2}
+
+// next - delay after d
+func (b Backoff) next(d time.Duration) time.Duration {
+	d = time.Duration(float64(d) * b.Multiplier)
+	if d > b.Max {
+		d = b.Max
+	}
+	return d
+}
+
+// backoff - Client.Backoff with defaults for zero fields
+func (c *Client) backoff() Backoff {
+	b := c.Backoff
+	if b.Initial <= 0 {
+		b.Initial = DefaultBackoff.Initial
+	}
+	if b.Max <= 0 {
+		b.Max = DefaultBackoff.Max
+	}
+	if b.Max < b.Initial {
+		b.Max = b.Initial
+	}
+	if b.Multiplier < 1 {
+		b.Multiplier = DefaultBackoff.Multiplier
+	}
+	return b
+}
+
+// retryable - checks if poll can be repeated after error: temporary API error or network error.
+// Invalid responses and wrong requests are not repeated, they won't get better
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Temporary()
+	}
+
+	// http.Client returns every error as url.Error, including wrong URL, so its cause is checked
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(urlErr.Err, &netErr) || errors.Is(urlErr.Err, io.EOF) || errors.Is(urlErr.Err, io.ErrUnexpectedEOF)
+}
+
+// sleep - waits for delay, or longer if server asked for it in Retry-After. Returns false if ctx is done
+func sleep(ctx context.Context, delay time.Duration, err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > delay {
+		delay = apiErr.RetryAfter
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Wait - polls expression with backoff until it is finished. Temporary API errors and network errors are retried until ctx is done.
+// Failed expression is not an error, check Expression.Err
+func (c *Client) Wait(ctx context.Context, id string) (*Expression, error) {
+	b := c.backoff()
+	delay := b.Initial
+
+	for {
+		expr, err := c.Get(ctx, id)
+		if err == nil && expr.Finished() {
+			return expr, nil
+		}
+		if err != nil && !retryable(ctx, err) {
+			return nil, err
+		}
+
+		if !sleep(ctx, delay, err) {
+			return nil, ctx.Err()
+		}
+		delay = b.next(delay)
+	}
+}
+
+// Calculate - submits expression and waits for its result. Failed expression is returned with its Err
+func (c *Client) Calculate(ctx context.Context, expression string, opts SubmitOptions) (*Expression, error) {
+	id, err := c.Submit(ctx, expression, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	expr, err := c.Wait(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return expr, expr.Err()
+}
+
+// Update - new status of streamed expression, or error after which expression is not streamed anymore
+type Update struct {
+	ID         string
+	Expression *Expression
+	Err        error
+}
+
+// Stream - sends update every time status of one of expressions changes. Channel is closed when all expressions
+// are finished or failed to load, or when ctx is done
+func (c *Client) Stream(ctx context.Context, ids ...string) <-chan Update {
+	updates := make(chan Update)
+
+	go func() {
+		defer close(updates)
+
+		b := c.backoff()
+		delay := b.Initial
+		statuses := make(map[string]string, len(ids))
+		pending := append([]string(nil), ids...)
+
+		send := func(u Update) bool {
+			select {
+			case updates <- u:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for len(pending) > 0 {
+			changed := false
+			var lastErr error
+			next := pending[:0]
+
+			for _, id := range pending {
+				expr, err := c.Get(ctx, id)
+				if err != nil {
+					if !retryable(ctx, err) {
+						if ctx.Err() != nil || !send(Update{ID: id, Err: err}) {
+							return
+						}
+						continue
+					}
+					lastErr = err
+					next = append(next, id)
+					continue
+				}
+
+				if statuses[id] != expr.Status {
+					statuses[id] = expr.Status
+					changed = true
+					if !send(Update{ID: id, Expression: expr}) {
+						return
+					}
+				}
+				if !expr.Finished() {
+					next = append(next, id)
+				}
+			}
+
+			pending = next
+			if len(pending) == 0 {
+				return
+			}
+
+			// changes are likely to be followed by more changes, so polling speeds up again
+			if changed {
+				delay = b.Initial
+			}
+			if !sleep(ctx, delay, lastErr) {
+				return
+			}
+			if !changed {
+				delay = b.next(delay)
+			}
+		}
+	}()
+
+	return updates
+}
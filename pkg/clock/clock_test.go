@@ -0,0 +1,45 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewFake(start)
+
+	var calls []time.Duration
+	record := func() { calls = append(calls, c.Now().Sub(start)) }
+
+	c.AfterFunc(3*time.Second, record)
+	c.AfterFunc(time.Second, func() {
+		record()
+		// timer created by timer is called in the same Advance if it is due
+		c.AfterFunc(time.Second, record)
+	})
+	stopped := c.AfterFunc(2*time.Second, record)
+
+	if !stopped.Stop() || stopped.Stop() {
+		t.Errorf("expected only first Stop to succeed")
+	}
+	if next, ok := c.Next(); !ok || next != start.Add(time.Second) {
+		t.Errorf("expected next call after 1s, got %v", next)
+	}
+
+	c.Advance(2500 * time.Millisecond)
+	if len(calls) != 2 || calls[0] != time.Second || calls[1] != 2*time.Second {
+		t.Errorf("unexpected calls %v", calls)
+	}
+	if got := c.Now().Sub(start); got != 2500*time.Millisecond {
+		t.Errorf("expected clock at 2.5s, got %v", got)
+	}
+
+	c.Advance(time.Second)
+	if len(calls) != 3 || calls[2] != 3*time.Second {
+		t.Errorf("unexpected calls %v", calls)
+	}
+	if _, ok := c.Next(); ok {
+		t.Errorf("expected no calls left")
+	}
+}
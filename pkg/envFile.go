@@ -0,0 +1,114 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+var (
+	envFileMu sync.Mutex
+	// processEnv - variables set before the first load, fileEnv - variables set from file by the last load
+	processEnv map[string]bool
+	fileEnv    map[string]bool
+)
+
+// LoadEnvFile - loads variables from file. Variables set in process environment before start are not overridden,
+// so they always win over the file. Variables removed from file since the previous load are unset.
+// Missing file is not an error and changes nothing, e.g. while editor replaces it
+func LoadEnvFile(path string) error {
+	envFileMu.Lock()
+	defer envFileMu.Unlock()
+
+	if processEnv == nil {
+		processEnv = make(map[string]bool)
+		for _, kv := range os.Environ() {
+			key, _, _ := strings.Cut(kv, "=")
+			processEnv[key] = true
+		}
+	}
+
+	values, err := godotenv.Read(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	loaded := make(map[string]bool, len(values))
+	for key, value := range values {
+		if processEnv[key] {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return err
+		}
+		loaded[key] = true
+	}
+
+	for key := range fileEnv {
+		if !loaded[key] {
+			if err := os.Unsetenv(key); err != nil {
+				return err
+			}
+		}
+	}
+	fileEnv = loaded
+
+	return nil
+}
+
+// WatchEnvFile - reloads file on SIGHUP or when its modification time changes and calls onReload after that.
+// Blocks until ctx is done
+func WatchEnvFile(ctx context.Context, path string, interval time.Duration, onReload func()) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastMod := modTime(path)
+
+	reload := func(reason string) {
+		if err := LoadEnvFile(path); err != nil {
+			slog.Error("Error reloading env file", "path", path, "error", err)
+			return
+		}
+		slog.Info("Reloaded env file", "path", path, "reason", reason)
+		onReload()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			lastMod = modTime(path)
+			reload("SIGHUP")
+		case <-ticker.C:
+			if mod := modTime(path); !mod.Equal(lastMod) {
+				lastMod = mod
+				reload("file changed")
+			}
+		}
+	}
+}
+
+// modTime - modification time of file or zero time if it doesn't exist
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
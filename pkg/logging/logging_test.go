@@ -0,0 +1,61 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddlewareRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Setup(&buf, "json", "debug"); err != nil {
+		t.Fatal(err)
+	}
+	defer slog.SetDefault(slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil)))
+
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slog.InfoContext(r.Context(), "Handled", "expression_id", "1")
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(RequestIDHeader); got != "req-1" {
+		t.Errorf("expected request ID in response, got %q", got)
+	}
+
+	var records []map[string]interface{}
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var record map[string]interface{}
+		if err := dec.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %v", len(records))
+	}
+	if records[0]["request_id"] != "req-1" || records[0]["expression_id"] != "1" {
+		t.Errorf("unexpected handler record %v", records[0])
+	}
+	if records[1]["level"] != "DEBUG" || records[1]["status"] != float64(http.StatusTeapot) {
+		t.Errorf("unexpected request record %v", records[1])
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	if err := SetLevel("loud"); err == nil {
+		t.Errorf("expected error for unknown level")
+	}
+	if err := SetLevel("warn"); err != nil || level.Level() != slog.LevelWarn {
+		t.Errorf("expected warn level, got %v (%v)", level.Level(), err)
+	}
+}
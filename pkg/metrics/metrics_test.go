@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	r := NewRegistry()
+
+	requests := r.Counter("requests_total", "Handled requests.", "method", "code")
+	requests.Inc("GET", "200")
+	requests.Add(2, "POST", "201")
+	requests.Add(-1, "GET", "200")
+
+	depth := r.Gauge("queue_depth", "Queued tasks.", "priority")
+	r.OnCollect(func() { depth.Set(3, `hi"gh`) })
+
+	r.GaugeFunc("workers", "Workers.", func() float64 { return 5 })
+
+	latency := r.Histogram("latency_seconds", "Latency.", []float64{1, 0.1}, "op")
+	latency.Observe(0.05, "+")
+	latency.Observe(0.5, "+")
+	latency.Observe(2, "+")
+
+	var sb strings.Builder
+	if _, err := r.WriteTo(&sb); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{op="+",le="0.1"} 1
+latency_seconds_bucket{op="+",le="1"} 2
+latency_seconds_bucket{op="+",le="+Inf"} 3
+latency_seconds_sum{op="+"} 2.55
+latency_seconds_count{op="+"} 3
+# HELP queue_depth Queued tasks.
+# TYPE queue_depth gauge
+queue_depth{priority="hi\"gh"} 3
+# HELP requests_total Handled requests.
+# TYPE requests_total counter
+requests_total{method="GET",code="200"} 1
+requests_total{method="POST",code="201"} 2
+# HELP workers Workers.
+# TYPE workers gauge
+workers 5
+`
+	if sb.String() != expected {
+		t.Errorf("unexpected output:\n%v\nexpected:\n%v", sb.String(), expected)
+	}
+}
+
+func TestLabelCountMismatch(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic on wrong amount of label values")
+		}
+	}()
+
+	NewRegistry().Counter("errors_total", "Errors.", "kind").Inc()
+}
@@ -0,0 +1,139 @@
+package sim
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/internal/orchestrator"
+)
+
+// orderedQueue - queue of orchestrator which keeps pushed tasks aside until flush. Evaluation goroutines push
+// tasks in random order, flush sorts them, so the same script always gives the same order
+type orderedQueue struct {
+	mu      sync.Mutex
+	queue   orchestrator.Queue
+	pending []*orchestrator.Task
+	// pushed - tasks which reached Push, flushed - tasks which reached scheduler
+	pushed  map[string]bool
+	flushed map[string]bool
+	order   map[string]int
+	// changed - signalled on every push, so simulation doesn't poll
+	changed chan struct{}
+}
+
+func newOrderedQueue() *orderedQueue {
+	return &orderedQueue{
+		queue:   orchestrator.NewScheduler(),
+		pushed:  make(map[string]bool),
+		flushed: make(map[string]bool),
+		order:   make(map[string]int),
+		changed: make(chan struct{}, 1),
+	}
+}
+
+func (q *orderedQueue) Push(task *orchestrator.Task) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = append(q.pending, task)
+	q.pushed[task.ID] = true
+
+	select {
+	case q.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (q *orderedQueue) Pop() (*orchestrator.Task, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.queue.Pop()
+}
+
+func (q *orderedQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.queue.Len() + len(q.pending)
+}
+
+func (q *orderedQueue) Depths() map[string]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	depths := q.queue.Depths()
+	for _, task := range q.pending {
+		depths[task.Priority()]++
+	}
+	return depths
+}
+
+func (q *orderedQueue) Snapshot() []orchestrator.QueuedTask {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	list := q.queue.Snapshot()
+	for _, task := range q.pending {
+		list = append(list, orchestrator.QueuedTask{
+			TaskID:       task.ID,
+			ExpressionID: task.ExpressionID,
+			Operation:    task.Operation,
+			Priority:     task.Priority(),
+			OwnerID:      task.OwnerID(),
+			QueuedAt:     task.QueuedAt(),
+		})
+	}
+	return list
+}
+
+func (q *orderedQueue) SetWeight(ownerID string, weight float64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if queue, ok := q.queue.(interface{ SetWeight(string, float64) }); ok {
+		queue.SetWeight(ownerID, weight)
+	}
+}
+
+// register - sets place of expression in flush order
+func (q *orderedQueue) register(expressionID string, n int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.order[expressionID] = n
+}
+
+// wasPushed - checks if task with ID ever reached queue
+func (q *orderedQueue) wasPushed(taskID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pushed[taskID]
+}
+
+// flush - moves pending tasks to scheduler in order of expressions, then operations and arguments.
+// Returns moved tasks and whether each of them was in queue before
+func (q *orderedQueue) flush() ([]*orchestrator.Task, []bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	tasks := q.pending
+	q.pending = nil
+	sort.SliceStable(tasks, func(i, j int) bool {
+		a, b := tasks[i], tasks[j]
+		if q.order[a.ExpressionID] != q.order[b.ExpressionID] {
+			return q.order[a.ExpressionID] < q.order[b.ExpressionID]
+		}
+		if a.Operation != b.Operation {
+			return a.Operation < b.Operation
+		}
+		if a.Arg1 != b.Arg1 {
+			return a.Arg1 < b.Arg1
+		}
+		return a.Arg2 < b.Arg2
+	})
+
+	requeued := make([]bool, len(tasks))
+	for i, task := range tasks {
+		requeued[i] = q.flushed[task.ID]
+		q.flushed[task.ID] = true
+		q.queue.Push(task)
+	}
+	return tasks, requeued
+}
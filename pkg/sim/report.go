@@ -0,0 +1,102 @@
+package sim
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/internal/orchestrator"
+)
+
+// Kinds of timeline entries. Entries with kinds of script events are written when event happens
+const (
+	// EntryQueued - task got into queue
+	EntryQueued = "queued"
+	// EntryRequeued - task returned to queue after lease expired
+	EntryRequeued = "requeued"
+	// EntryStart - agent took task
+	EntryStart = "start"
+	// EntryDone - agent sent result of task
+	EntryDone = "done"
+	// EntryFinish - expression got final status
+	EntryFinish = "finish"
+)
+
+// Report - result of simulation
+type Report struct {
+	// Timeline - everything that happened, in order
+	Timeline    []Entry
+	Expressions []ExpressionReport
+	Agents      []AgentReport
+	// Duration - virtual time of the last entry
+	Duration time.Duration
+}
+
+// Entry - one line of timeline. Time is counted from beginning of simulation
+type Entry struct {
+	At         time.Duration
+	Kind       string
+	Agent      string
+	Expression string
+	Detail     string
+}
+
+// ExpressionReport - final state of expression. Done is false if simulation ended before expression finished
+type ExpressionReport struct {
+	Name       string
+	Expression string
+	Status     string
+	Result     float64
+	Done       bool
+	Submitted  time.Duration
+	Finished   time.Duration
+}
+
+// Latency - time from submit to final status
+func (e ExpressionReport) Latency() time.Duration {
+	return e.Finished - e.Submitted
+}
+
+// AgentReport - work done by agent. Busy includes time of task lost in crash
+type AgentReport struct {
+	Name    string
+	Tasks   int
+	Busy    time.Duration
+	Crashed bool
+}
+
+// Print - writes timeline and summary as tables
+func (r *Report) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "TIME\tEVENT\tAGENT\tEXPRESSION\tDETAIL")
+	for _, e := range r.Timeline {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n", e.At, e.Kind, e.Agent, e.Expression, e.Detail)
+	}
+
+	fmt.Fprintln(tw, "\nEXPRESSION\tSTATUS\tRESULT\tSUBMITTED\tLATENCY")
+	for _, e := range r.Expressions {
+		result, latency := "", ""
+		if e.Status == orchestrator.StatusCompleted {
+			result = formatFloat(e.Result)
+		}
+		if e.Done {
+			latency = e.Latency().String()
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n", e.Name, e.Status, result, e.Submitted, latency)
+	}
+
+	fmt.Fprintln(tw, "\nAGENT\tTASKS\tBUSY\tCRASHED")
+	for _, a := range r.Agents {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", a.Name, a.Tasks, a.Busy, a.Crashed)
+	}
+
+	fmt.Fprintf(tw, "\nTotal time: %v\n", r.Duration)
+	return tw.Flush()
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,222 @@
+package sim
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of script events
+const (
+	// EventSubmit - expression is sent to orchestrator
+	EventSubmit = "submit"
+	// EventAgents - new agents join, each takes one task at a time
+	EventAgents = "agents"
+	// EventCrash - agent stops, its task stays leased until lease expires
+	EventCrash = "crash"
+	// EventDelay - agent calculates every next task longer by Delay
+	EventDelay = "delay"
+	// EventWeight - scheduling weight of owner is changed
+	EventWeight = "weight"
+)
+
+// Script - settings of orchestrator and events of simulation
+type Script struct {
+	// OperationTimes - time of "+", "-", "*" and "/". Missing operations are instant
+	OperationTimes map[string]time.Duration
+	// LeaseTimeout - time given to agent over operation time before task returns to queue, 10s by default
+	LeaseTimeout time.Duration
+	// MaxRetries - how many times lost task returns to queue before expression fails
+	MaxRetries int
+	// Events - events in order of time. Events with equal time happen in order of the list
+	Events []Event
+}
+
+// Event - one step of script
+type Event struct {
+	At   time.Duration
+	Kind string
+
+	// Name - name of expression for submit, name of agent for crash and delay
+	Name       string
+	Expression string
+	Priority   string
+	// Owner - owner of expression for submit and weight, "sim" by default
+	Owner string
+
+	Count  int
+	Delay  time.Duration
+	Weight float64
+}
+
+// Parse - reads script in text format. Settings are written without time:
+//
+//	time * 2s
+//	lease 5s
+//	retries 1
+//
+// Events start with time from beginning of simulation:
+//
+//	0s    agents 2
+//	0s    submit a (1+2)*(3+4) priority=high owner=bob
+//	500ms crash agent-1
+//	1s    delay agent-2 3s
+//	1s    weight bob 2
+//
+// Agents are named agent-1, agent-2 and so on in order of joining. Everything after # is a comment
+func Parse(r io.Reader) (Script, error) {
+	script := Script{OperationTimes: make(map[string]time.Duration), MaxRetries: 3}
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if err := script.parseLine(fields); err != nil {
+			return Script{}, fmt.Errorf("line %v: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Script{}, err
+	}
+
+	sort.SliceStable(script.Events, func(i, j int) bool { return script.Events[i].At < script.Events[j].At })
+	return script, nil
+}
+
+func (s *Script) parseLine(fields []string) error {
+	switch fields[0] {
+	case "time":
+		if len(fields) != 3 {
+			return errors.New("usage: time <operation> <duration>")
+		}
+		d, err := parseDuration(fields[2])
+		if err != nil {
+			return err
+		}
+		s.OperationTimes[fields[1]] = d
+		return nil
+	case "lease":
+		if len(fields) != 2 {
+			return errors.New("usage: lease <duration>")
+		}
+		d, err := parseDuration(fields[1])
+		if err != nil {
+			return err
+		}
+		s.LeaseTimeout = d
+		return nil
+	case "retries":
+		if len(fields) != 2 {
+			return errors.New("usage: retries <n>")
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid retries %q", fields[1])
+		}
+		s.MaxRetries = n
+		return nil
+	}
+
+	at, err := parseDuration(fields[0])
+	if err != nil {
+		return fmt.Errorf("expected setting or time of event, got %q", fields[0])
+	}
+	if len(fields) < 2 {
+		return errors.New("missing event after time")
+	}
+
+	event, err := parseEvent(fields[1], fields[2:])
+	if err != nil {
+		return err
+	}
+	event.At = at
+	s.Events = append(s.Events, event)
+	return nil
+}
+
+func parseEvent(kind string, args []string) (Event, error) {
+	event := Event{Kind: kind}
+
+	switch kind {
+	case EventSubmit:
+		if len(args) < 2 {
+			return event, errors.New("usage: submit <name> <expression> [priority=p] [owner=o]")
+		}
+		event.Name = args[0]
+		args = args[1:]
+
+		// options are at the end, expression itself has no '='
+		for len(args) > 1 && strings.Contains(args[len(args)-1], "=") {
+			key, value, _ := strings.Cut(args[len(args)-1], "=")
+			switch key {
+			case "priority":
+				event.Priority = value
+			case "owner":
+				event.Owner = value
+			default:
+				return event, fmt.Errorf("unknown option %q", key)
+			}
+			args = args[:len(args)-1]
+		}
+		event.Expression = strings.Join(args, " ")
+	case EventAgents:
+		if len(args) != 1 {
+			return event, errors.New("usage: agents <count>")
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return event, fmt.Errorf("invalid count %q", args[0])
+		}
+		event.Count = n
+	case EventCrash:
+		if len(args) != 1 {
+			return event, errors.New("usage: crash <agent>")
+		}
+		event.Name = args[0]
+	case EventDelay:
+		if len(args) != 2 {
+			return event, errors.New("usage: delay <agent> <duration>")
+		}
+		d, err := parseDuration(args[1])
+		if err != nil {
+			return event, err
+		}
+		event.Name = args[0]
+		event.Delay = d
+	case EventWeight:
+		if len(args) != 2 {
+			return event, errors.New("usage: weight <owner> <weight>")
+		}
+		w, err := strconv.ParseFloat(args[1], 64)
+		if err != nil || w <= 0 {
+			return event, fmt.Errorf("invalid weight %q", args[1])
+		}
+		event.Owner = args[0]
+		event.Weight = w
+	default:
+		return event, fmt.Errorf("unknown event %q", kind)
+	}
+	return event, nil
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %q", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,440 @@
+// Package sim - runs orchestrator with simulated agents on a virtual clock. Agents don't sleep, time jumps to the
+// next event, so minutes of scheduling are simulated in milliseconds and the same script always gives the same report
+package sim
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/internal/orchestrator"
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/calc"
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/clock"
+)
+
+// defaultOwner - owner of expressions submitted without owner
+const defaultOwner = "sim"
+
+type simulation struct {
+	ctx   context.Context
+	clock *clock.Fake
+	start time.Time
+	queue *orderedQueue
+	orch  *orchestrator.Orchestrator
+
+	agents      []*agent
+	expressions []*expression
+	byID        map[string]*expression
+	byName      map[string]*expression
+	timeline    []Entry
+}
+
+// agent - simulated agent with one worker
+type agent struct {
+	name    string
+	delay   time.Duration
+	crashed bool
+	task    *orchestrator.Task
+	timer   clock.Timer
+	started time.Time
+	tasks   int
+	busy    time.Duration
+}
+
+type expression struct {
+	name   string
+	id     string
+	text   string
+	tree   *calc.Node
+	status string
+	result float64
+	done   bool
+	// finish - closed when orchestrator finishes expression
+	finish    chan struct{}
+	submitted time.Duration
+	finished  time.Duration
+}
+
+// taskKey - operation with its arguments, identifies task inside expression. Bits are used, so NaN is equal to itself
+type taskKey struct {
+	operation  string
+	arg1, arg2 uint64
+}
+
+// Run - plays script and returns timeline. Results cache is turned off, so every operation goes to agents
+func Run(script Script) (*Report, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, err := newSimulation(ctx, script)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := s.orch.Start()
+	defer stop()
+
+	events := append([]Event(nil), script.Events...)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At < events[j].At })
+
+	for {
+		s.settle()
+		// agents take tasks when all events of this moment are played
+		if len(events) == 0 || s.start.Add(events[0].At).After(s.clock.Now()) {
+			s.dispatch()
+		}
+
+		// timers (results of agents and lease expirations) go before events of the same time
+		next, ok := s.clock.Next()
+		if len(events) > 0 {
+			at := s.start.Add(events[0].At)
+			if !ok || at.Before(next) {
+				s.clock.AdvanceTo(at)
+				if err := s.apply(events[0]); err != nil {
+					return nil, err
+				}
+				events = events[1:]
+				continue
+			}
+		}
+		if !ok {
+			return s.report(), nil
+		}
+		s.clock.AdvanceTo(next)
+	}
+}
+
+func newSimulation(ctx context.Context, script Script) (*simulation, error) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := &simulation{
+		ctx:    ctx,
+		clock:  clock.NewFake(start),
+		start:  start,
+		queue:  newOrderedQueue(),
+		byID:   make(map[string]*expression),
+		byName: make(map[string]*expression),
+	}
+
+	times := make(map[string]time.Duration)
+	for _, op := range []string{"+", "-", "*", "/"} {
+		times[op] = script.OperationTimes[op]
+	}
+
+	// IDs are requested by evaluation goroutines concurrently
+	var ids atomic.Int64
+	s.orch = orchestrator.NewOrchestrator(
+		orchestrator.WithClock(s.clock),
+		orchestrator.WithQueue(s.queue),
+		orchestrator.WithIDGenerator(func() string { return "id-" + strconv.FormatInt(ids.Add(1), 10) }),
+		orchestrator.WithOperationTimes(times),
+	)
+
+	cfg := s.orch.Config()
+	if script.LeaseTimeout > 0 {
+		cfg.LeaseTimeoutMs = int(script.LeaseTimeout.Milliseconds())
+	}
+	cfg.MaxRetries = script.MaxRetries
+	if err := s.orch.SetConfig(cfg); err != nil {
+		return nil, fmt.Errorf("invalid script: %w", err)
+	}
+	return s, nil
+}
+
+// now - virtual time from beginning of simulation
+func (s *simulation) now() time.Duration {
+	return s.clock.Now().Sub(s.start)
+}
+
+func (s *simulation) record(e Entry) {
+	e.At = s.now()
+	s.timeline = append(s.timeline, e)
+}
+
+// apply - plays one event of script
+func (s *simulation) apply(event Event) error {
+	switch event.Kind {
+	case EventSubmit:
+		return s.submit(event)
+	case EventAgents:
+		for i := 0; i < event.Count; i++ {
+			a := &agent{name: "agent-" + strconv.Itoa(len(s.agents)+1)}
+			s.agents = append(s.agents, a)
+			s.record(Entry{Kind: EventAgents, Agent: a.name, Detail: "joined"})
+		}
+	case EventCrash:
+		a, err := s.agent(event.Name)
+		if err != nil {
+			return err
+		}
+		a.crashed = true
+		entry := Entry{Kind: EventCrash, Agent: a.name}
+		if a.task != nil {
+			a.timer.Stop()
+			a.busy += s.clock.Now().Sub(a.started)
+			entry.Expression = s.byID[a.task.ExpressionID].name
+			entry.Detail = "lost " + describe(a.task)
+			a.task = nil
+		}
+		s.record(entry)
+	case EventDelay:
+		a, err := s.agent(event.Name)
+		if err != nil {
+			return err
+		}
+		a.delay = event.Delay
+		s.record(Entry{Kind: EventDelay, Agent: a.name, Detail: "+" + event.Delay.String() + " per task"})
+	case EventWeight:
+		s.queue.SetWeight(event.Owner, event.Weight)
+		s.record(Entry{Kind: EventWeight, Detail: event.Owner + " = " + formatFloat(event.Weight)})
+	default:
+		return fmt.Errorf("unknown event %q", event.Kind)
+	}
+	return nil
+}
+
+func (s *simulation) agent(name string) (*agent, error) {
+	for _, a := range s.agents {
+		if a.name == name {
+			return a, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown agent %q", name)
+}
+
+func (s *simulation) submit(event Event) error {
+	if _, ok := s.byName[event.Name]; ok {
+		return fmt.Errorf("expression %q is submitted twice", event.Name)
+	}
+
+	owner := event.Owner
+	if owner == "" {
+		owner = defaultOwner
+	}
+	id, err := s.orch.Submit(context.Background(), owner, orchestrator.ExpressionRequest{
+		Expression: event.Expression,
+		Priority:   event.Priority,
+		NoCache:    true,
+	})
+	if err != nil {
+		return fmt.Errorf("submitting %v: %w", event.Name, err)
+	}
+
+	// invalid expression has no tree, orchestrator fails it by itself
+	tree, _ := calc.Parse(event.Expression)
+	e := &expression{name: event.Name, id: id, text: event.Expression, tree: tree, submitted: s.now(), finish: make(chan struct{})}
+	go func() {
+		s.orch.Wait(s.ctx, id)
+		close(e.finish)
+	}()
+	s.queue.register(id, len(s.expressions))
+	s.expressions = append(s.expressions, e)
+	s.byID[id] = e
+	s.byName[e.name] = e
+
+	s.record(Entry{Kind: EventSubmit, Expression: e.name, Detail: e.text})
+	return nil
+}
+
+// settle - waits until every expression queued all tasks it can, then records finished expressions
+// and moves queued tasks to scheduler in fixed order. Unsettled expression waits only for a push or its finish,
+// so there are no timeouts of real time
+func (s *simulation) settle() {
+	for {
+		e := s.unsettled()
+		if e == nil {
+			break
+		}
+		select {
+		case <-s.queue.changed:
+		case <-e.finish:
+		}
+	}
+
+	for _, e := range s.expressions {
+		if e.done {
+			continue
+		}
+		expr, err := s.orch.Expression(e.id)
+		if err != nil {
+			continue
+		}
+		e.status, e.result = expr.Status, expr.Result
+		if finished(expr.Status) {
+			e.done = true
+			e.finished = s.now()
+			detail := expr.Status
+			if expr.Status == orchestrator.StatusCompleted {
+				detail += " = " + formatFloat(expr.Result)
+			}
+			s.record(Entry{Kind: EntryFinish, Expression: e.name, Detail: detail})
+		}
+	}
+
+	tasks, requeued := s.queue.flush()
+	for i, task := range tasks {
+		kind := EntryQueued
+		if requeued[i] {
+			kind = EntryRequeued
+		}
+		s.record(Entry{Kind: kind, Expression: s.byID[task.ExpressionID].name, Detail: describe(task)})
+	}
+}
+
+// unsettled - returns the first expression which is still being evaluated by orchestrator
+func (s *simulation) unsettled() *expression {
+	for _, e := range s.expressions {
+		if e.done {
+			continue
+		}
+		expr, err := s.orch.Expression(e.id)
+		if err != nil || !s.settled(e, expr) {
+			return e
+		}
+	}
+	return nil
+}
+
+// settled - expression is settled when it is finished or every operation with known arguments has a queued task.
+// Expression with failed task or with result of root operation is settled only after it finishes
+func (s *simulation) settled(e *expression, expr *orchestrator.Expression) bool {
+	if finished(expr.Status) {
+		return true
+	}
+	if e.tree == nil {
+		return false
+	}
+
+	completed := make(map[taskKey]float64)
+	pushed := make(map[taskKey]bool)
+	for _, task := range expr.Tasks {
+		key := keyOf(task.Operation, task.Arg1, task.Arg2)
+		switch task.Status {
+		case orchestrator.StatusError:
+			return false
+		case orchestrator.StatusCompleted:
+			completed[key] = task.Result
+		}
+		if s.queue.wasPushed(task.ID) {
+			pushed[key] = true
+		}
+	}
+
+	_, resolved, ok := walk(e.tree, completed, pushed)
+	return ok && !resolved
+}
+
+// walk - calculates node from results of completed tasks. Returns false in the last value if some operation
+// could be queued but wasn't
+func walk(node *calc.Node, completed map[taskKey]float64, pushed map[taskKey]bool) (float64, bool, bool) {
+	if node.Operation == "" {
+		return node.Value, true, true
+	}
+
+	left, leftResolved, ok := walk(node.Left, completed, pushed)
+	if !ok {
+		return 0, false, false
+	}
+	right, rightResolved, ok := walk(node.Right, completed, pushed)
+	if !ok {
+		return 0, false, false
+	}
+	if !leftResolved || !rightResolved {
+		return 0, false, true
+	}
+
+	key := keyOf(node.Operation, left, right)
+	if result, ok := completed[key]; ok {
+		return result, true, true
+	}
+	return 0, false, pushed[key]
+}
+
+// dispatch - gives queued tasks to idle agents in order of joining
+func (s *simulation) dispatch() {
+	for _, a := range s.agents {
+		if a.crashed || a.task != nil {
+			continue
+		}
+		task, _ := s.orch.LeaseTask(context.Background(), a.name)
+		if task == nil {
+			return
+		}
+
+		a.task = task
+		a.started = s.clock.Now()
+		d := time.Duration(task.OperationTime)*time.Millisecond + a.delay
+		a.timer = s.clock.AfterFunc(d, func() { s.complete(a) })
+		s.record(Entry{Kind: EntryStart, Agent: a.name, Expression: s.byID[task.ExpressionID].name, Detail: describe(task)})
+	}
+}
+
+// complete - agent sends result of its task
+func (s *simulation) complete(a *agent) {
+	task := a.task
+	a.task, a.timer = nil, nil
+	a.tasks++
+	a.busy += s.clock.Now().Sub(a.started)
+
+	result := calculate(task)
+	detail := describe(task) + " = " + formatFloat(result)
+	err := s.orch.CompleteTask(context.Background(), a.name, orchestrator.TaskResult{
+		ID:           task.ID,
+		ExpressionID: task.ExpressionID,
+		Result:       result,
+	})
+	if err != nil {
+		detail += " (" + err.Error() + ")"
+	}
+	s.record(Entry{Kind: EntryDone, Agent: a.name, Expression: s.byID[task.ExpressionID].name, Detail: detail})
+}
+
+func (s *simulation) report() *Report {
+	r := &Report{Timeline: s.timeline, Duration: s.now()}
+	for _, e := range s.expressions {
+		r.Expressions = append(r.Expressions, ExpressionReport{
+			Name:       e.name,
+			Expression: e.text,
+			Status:     e.status,
+			Result:     e.result,
+			Done:       e.done,
+			Submitted:  e.submitted,
+			Finished:   e.finished,
+		})
+	}
+	for _, a := range s.agents {
+		r.Agents = append(r.Agents, AgentReport{Name: a.name, Tasks: a.tasks, Busy: a.busy, Crashed: a.crashed})
+	}
+	return r
+}
+
+// calculate - result of task, the same as real agent gives
+func calculate(task *orchestrator.Task) float64 {
+	switch task.Operation {
+	case "+":
+		return task.Arg1 + task.Arg2
+	case "-":
+		return task.Arg1 - task.Arg2
+	case "*":
+		return task.Arg1 * task.Arg2
+	case "/":
+		return task.Arg1 / task.Arg2
+	default:
+		return 0
+	}
+}
+
+func describe(task *orchestrator.Task) string {
+	return formatFloat(task.Arg1) + task.Operation + formatFloat(task.Arg2)
+}
+
+func keyOf(operation string, arg1, arg2 float64) taskKey {
+	return taskKey{operation: operation, arg1: math.Float64bits(arg1), arg2: math.Float64bits(arg2)}
+}
+
+func finished(status string) bool {
+	return status == orchestrator.StatusCompleted || status == orchestrator.StatusError || status == orchestrator.StatusCancelled
+}
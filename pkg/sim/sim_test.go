@@ -0,0 +1,117 @@
+package sim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+const crashScript = `
+time + 1s
+time * 2s
+lease 3s
+retries 1
+
+0s    agents 2
+0s    submit a (1+2)*(3+4)
+0s    submit b 5*5 priority=high
+500ms crash agent-1   # takes b first because of priority
+`
+
+func run(t *testing.T, text string) *Report {
+	t.Helper()
+	script, err := Parse(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := Run(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func TestCrash(t *testing.T) {
+	report := run(t, crashScript)
+
+	expected := []Entry{
+		{At: 0, Kind: EntryStart, Agent: "agent-1", Expression: "b", Detail: "5*5"},
+		{At: 0, Kind: EntryStart, Agent: "agent-2", Expression: "a", Detail: "1+2"},
+		{At: 500 * time.Millisecond, Kind: EventCrash, Agent: "agent-1", Expression: "b", Detail: "lost 5*5"},
+		{At: 4 * time.Second, Kind: EntryFinish, Expression: "a", Detail: "completed = 21"},
+		// lease of b expires after 2s of operation and 3s of lease timeout
+		{At: 5 * time.Second, Kind: EntryRequeued, Expression: "b", Detail: "5*5"},
+		{At: 5 * time.Second, Kind: EntryStart, Agent: "agent-2", Expression: "b", Detail: "5*5"},
+		{At: 7 * time.Second, Kind: EntryFinish, Expression: "b", Detail: "completed = 25"},
+	}
+	next := 0
+	for _, entry := range report.Timeline {
+		if next < len(expected) && entry == expected[next] {
+			next++
+		}
+	}
+	if next != len(expected) {
+		var out bytes.Buffer
+		report.Print(&out)
+		t.Fatalf("expected entry %+v in timeline:\n%v", expected[next], out.String())
+	}
+
+	if report.Duration != 7*time.Second || report.Agents[1].Tasks != 4 || !report.Agents[0].Crashed {
+		t.Errorf("unexpected summary %+v %+v", report.Duration, report.Agents)
+	}
+}
+
+// tieScript - flows of all owners have equal pass and priority, so only tie-breaking decides the order
+const tieScript = `
+time + 1s
+
+0s agents 1
+0s submit a 1+1 owner=alice
+0s submit b 2+2 owner=bob
+0s submit c 3+3 owner=carol
+0s submit d 4+4 owner=dave
+`
+
+func TestDeterministic(t *testing.T) {
+	for _, script := range []string{crashScript, tieScript} {
+		var first bytes.Buffer
+		run(t, script).Print(&first)
+
+		for i := 0; i < 10; i++ {
+			var out bytes.Buffer
+			run(t, script).Print(&out)
+			if out.String() != first.String() {
+				t.Fatalf("reports differ:\n%v\n%v", first.String(), out.String())
+			}
+		}
+	}
+
+	// owners are served in order of their first task
+	var order []string
+	for _, entry := range run(t, tieScript).Timeline {
+		if entry.Kind == EntryStart {
+			order = append(order, entry.Expression)
+		}
+	}
+	if strings.Join(order, "") != "abcd" {
+		t.Errorf("expected expressions in order abcd, got %v", order)
+	}
+}
+
+func TestRetriesExhausted(t *testing.T) {
+	report := run(t, `
+time + 1s
+lease 1s
+retries 0
+
+0s agents 1
+0s submit a 1+2
+500ms crash agent-1
+`)
+
+	a := report.Expressions[0]
+	if a.Status != "error" || !a.Done || a.Finished != 2*time.Second {
+		t.Errorf("expected expression to fail after lease expired, got %+v", a)
+	}
+}
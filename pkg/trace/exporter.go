@@ -0,0 +1,64 @@
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// WriterExporter - writes spans as JSON lines, e.g. to stdout or file
+type WriterExporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	// file - opened by NewExporter and closed by Close
+	file *os.File
+}
+
+// NewWriterExporter - creates exporter which writes one JSON object per span to w
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{enc: json.NewEncoder(w)}
+}
+
+// Export - writes span
+func (e *WriterExporter) Export(span SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.enc.Encode(span)
+}
+
+// Close - closes file opened by NewExporter. Writer passed to NewWriterExporter is not closed
+func (e *WriterExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.file == nil {
+		return nil
+	}
+	err := e.file.Close()
+	e.file = nil
+	return err
+}
+
+// NewExporter - creates exporter by name: "stdout", "file" (appends to path) or "" for no tracing
+func NewExporter(kind, path string) (Exporter, error) {
+	switch kind {
+	case "":
+		return nil, nil
+	case "stdout":
+		return NewWriterExporter(os.Stdout), nil
+	case "file":
+		if path == "" {
+			return nil, fmt.Errorf("file exporter needs path")
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		exporter := NewWriterExporter(f)
+		exporter.file = f
+		return exporter, nil
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", kind)
+	}
+}
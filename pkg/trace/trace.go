@@ -0,0 +1,197 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/clock"
+)
+
+// Header - W3C trace context header which carries trace between processes
+const Header = "traceparent"
+
+// SpanContext - identifiers of span which are propagated to child spans and other processes
+type SpanContext struct {
+	TraceID string `json:"trace_id"`
+	SpanID  string `json:"span_id"`
+}
+
+// IsValid - checks that span context has both identifiers
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != "" && sc.SpanID != ""
+}
+
+// SpanData - finished span passed to exporter
+type SpanData struct {
+	SpanContext
+	ParentID   string            `json:"parent_id,omitempty"`
+	Service    string            `json:"service"`
+	Name       string            `json:"name"`
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	DurationMs float64           `json:"duration_ms"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// Exporter - receives finished spans. Must be safe for concurrent use
+type Exporter interface {
+	Export(span SpanData)
+}
+
+// Tracer - creates spans of one service and sends them to exporter. Nil exporter discards spans
+type Tracer struct {
+	service  string
+	exporter Exporter
+	clock    clock.Clock
+}
+
+// NewTracer - creates tracer for service with real time
+func NewTracer(service string, exporter Exporter) *Tracer {
+	return &Tracer{service: service, exporter: exporter, clock: clock.Real()}
+}
+
+// WithClock - returns tracer which takes time of spans from c. Must be the clock of times passed to StartAt,
+// otherwise durations mix two time bases
+func (t *Tracer) WithClock(c clock.Clock) *Tracer {
+	return &Tracer{service: t.service, exporter: t.exporter, clock: c}
+}
+
+// Close - closes exporter if it holds resources, e.g. file. Spans ended after Close are lost
+func (t *Tracer) Close() error {
+	if closer, ok := t.exporter.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Span - operation in trace. Methods are safe for concurrent use, End exports span only once
+type Span struct {
+	tracer *Tracer
+	data   SpanData
+
+	mu    sync.Mutex
+	ended bool
+}
+
+type spanKey struct{}
+
+// Start - starts span which is child of span in ctx, or root of new trace. Returns ctx with new span
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	return t.StartAt(ctx, name, t.clock.Now())
+}
+
+// StartAt - same as Start but with explicit start time, e.g. for waiting which is known only after it ends
+func (t *Tracer) StartAt(ctx context.Context, name string, start time.Time) (context.Context, *Span) {
+	span := &Span{
+		tracer: t,
+		data: SpanData{
+			SpanContext: SpanContext{SpanID: newID(8)},
+			Service:     t.service,
+			Name:        name,
+			Start:       start,
+		},
+	}
+
+	if parent := FromContext(ctx); parent.IsValid() {
+		span.data.TraceID = parent.TraceID
+		span.data.ParentID = parent.SpanID
+	} else {
+		span.data.TraceID = newID(16)
+	}
+
+	return context.WithValue(ctx, spanKey{}, span.data.SpanContext), span
+}
+
+// Context - identifiers of span for children and propagation
+func (s *Span) Context() SpanContext {
+	return s.data.SpanContext
+}
+
+// SetAttr - adds attribute to span
+func (s *Span) SetAttr(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]string)
+	}
+	s.data.Attributes[key] = value
+}
+
+// SetError - marks span as failed
+func (s *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Error = err.Error()
+}
+
+// End - finishes span and sends it to exporter
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = s.tracer.clock.Now()
+	s.data.DurationMs = float64(s.data.End.Sub(s.data.Start).Microseconds()) / 1000
+	data := s.data
+	s.mu.Unlock()
+
+	if s.tracer.exporter != nil {
+		s.tracer.exporter.Export(data)
+	}
+}
+
+// ContextWith - returns ctx with span context, e.g. received from other process, as parent of new spans
+func ContextWith(ctx context.Context, sc SpanContext) context.Context {
+	if !sc.IsValid() {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, sc)
+}
+
+// FromContext - span context stored in ctx, empty if there is none
+func FromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanKey{}).(SpanContext)
+	return sc
+}
+
+// Inject - writes span context to traceparent header
+func Inject(h http.Header, sc SpanContext) {
+	if sc.IsValid() {
+		h.Set(Header, "00-"+sc.TraceID+"-"+sc.SpanID+"-01")
+	}
+}
+
+// Extract - reads span context from traceparent header. Returns false if header is missing or malformed
+func Extract(h http.Header) (SpanContext, bool) {
+	parts := strings.Split(h.Get(Header), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return SpanContext{}, false
+	}
+	if !isHex(parts[1]) || !isHex(parts[2]) {
+		return SpanContext{}, false
+	}
+	return SpanContext{TraceID: parts[1], SpanID: parts[2]}, true
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func newID(size int) string {
+	b := make([]byte, size)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
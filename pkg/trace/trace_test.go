@@ -0,0 +1,103 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AzizovHikmatullo/calc-go_V2/pkg/clock"
+)
+
+func TestSpansAndPropagation(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewTracer("test", NewWriterExporter(&buf))
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	_, child := tracer.Start(ctx, "child")
+	child.SetAttr("key", "value")
+	child.SetError(errors.New("failed"))
+	child.End()
+	child.End()
+
+	h := http.Header{}
+	Inject(h, child.Context())
+	remote, ok := Extract(h)
+	if !ok || remote != child.Context() {
+		t.Fatalf("expected %v after propagation, got %v", child.Context(), remote)
+	}
+
+	_, other := tracer.Start(ContextWith(context.Background(), remote), "remote")
+	other.End()
+	root.End()
+
+	var spans []SpanData
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var span SpanData
+		if err := dec.Decode(&span); err != nil {
+			t.Fatal(err)
+		}
+		spans = append(spans, span)
+	}
+
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 exported spans, got %v", len(spans))
+	}
+	if spans[0].ParentID != root.Context().SpanID || spans[0].Attributes["key"] != "value" || spans[0].Error != "failed" {
+		t.Errorf("unexpected child span %+v", spans[0])
+	}
+	if spans[1].ParentID != child.Context().SpanID || spans[1].TraceID != root.Context().TraceID {
+		t.Errorf("remote span is not child of propagated span: %+v", spans[1])
+	}
+	if spans[2].ParentID != "" || spans[2].Service != "test" {
+		t.Errorf("unexpected root span %+v", spans[2])
+	}
+}
+
+func TestExtractInvalid(t *testing.T) {
+	for _, value := range []string{"", "00-abc-def-01", "00-0af7651916cd43dd8448eb211c80319c-zzzzzzzzzzzzzzzz-01"} {
+		h := http.Header{}
+		h.Set(Header, value)
+		if _, ok := Extract(h); ok {
+			t.Errorf("expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestClockAndClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+	exporter, err := NewExporter("file", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	tracer := NewTracer("test", exporter).WithClock(fake)
+
+	_, span := tracer.StartAt(context.Background(), "queue_wait", start.Add(-time.Second))
+	fake.Advance(500 * time.Millisecond)
+	span.End()
+
+	if err := tracer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exported SpanData
+	if err := json.Unmarshal(data, &exported); err != nil {
+		t.Fatal(err)
+	}
+	if exported.DurationMs != 1500 || !exported.End.Equal(start.Add(500*time.Millisecond)) {
+		t.Errorf("expected span of 1500ms by fake clock, got %+v", exported)
+	}
+}
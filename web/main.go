@@ -1,17 +1,19 @@
 package main
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
 )
 
 func main() {
 	fs := http.FileServer(http.Dir("./static"))
 	http.Handle("/", fs)
 
-	log.Println("Starting frontend server on http://localhost:8081")
+	slog.Info("Starting frontend server", "url", "http://localhost:8081")
 	err := http.ListenAndServe(":8081", nil)
 	if err != nil {
-		log.Fatalf("Failed to start frontend server: %v", err)
+		slog.Error("Failed to start frontend server", "error", err)
+		os.Exit(1)
 	}
 }
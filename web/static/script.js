@@ -1,6 +1,60 @@
 document.addEventListener("DOMContentLoaded", () => {
     const API_BASE_URL = "http://localhost:8080";
 
+    const authStatus = document.getElementById("authStatus");
+    const authHeaders = () => {
+        const token = localStorage.getItem("token");
+        return token ? { Authorization: `Bearer ${token}` } : {};
+    };
+    const showAuthStatus = () => {
+        const login = localStorage.getItem("login");
+        authStatus.textContent = login ? `Вы вошли как ${login}` : "Вы не вошли";
+    };
+    showAuthStatus();
+
+    const sendCredentials = async (path) => {
+        const login = document.getElementById("loginInput").value;
+        const password = document.getElementById("passwordInput").value;
+        return fetch(`${API_BASE_URL}/api/v1/${path}`, {
+            method: "POST",
+            headers: { "Content-Type": "application/json" },
+            body: JSON.stringify({ login, password }),
+        });
+    };
+
+    const authForm = document.getElementById("authForm");
+    authForm.addEventListener("submit", async (e) => {
+        e.preventDefault();
+
+        try {
+            const response = await sendCredentials("login");
+            if (!response.ok) {
+                throw new Error(`Ошибка: ${response.status}`);
+            }
+
+            const data = await response.json();
+            localStorage.setItem("token", data.token);
+            localStorage.setItem("login", document.getElementById("loginInput").value);
+            showAuthStatus();
+        } catch (error) {
+            alert(`Не удалось войти: ${error.message}`);
+        }
+    });
+
+    const registerButton = document.getElementById("registerButton");
+    registerButton.addEventListener("click", async () => {
+        try {
+            const response = await sendCredentials("register");
+            if (!response.ok) {
+                throw new Error(`Ошибка: ${response.status}`);
+            }
+
+            alert("Пользователь зарегистрирован, теперь можно войти");
+        } catch (error) {
+            alert(`Не удалось зарегистрироваться: ${error.message}`);
+        }
+    });
+
     const expressionForm = document.getElementById("expressionForm");
     expressionForm.addEventListener("submit", async (e) => {
         e.preventDefault();
@@ -9,7 +63,7 @@ document.addEventListener("DOMContentLoaded", () => {
         try {
             const response = await fetch(`${API_BASE_URL}/api/v1/calculate`, {
                 method: "POST",
-                headers: { "Content-Type": "application/json" },
+                headers: { "Content-Type": "application/json", ...authHeaders() },
                 body: JSON.stringify({ expression }),
             });
 
@@ -28,7 +82,7 @@ document.addEventListener("DOMContentLoaded", () => {
     const expressionsList = document.getElementById("expressionsList");
     refreshListButton.addEventListener("click", async () => {
         try {
-            const response = await fetch(`${API_BASE_URL}/api/v1/expressions`);
+            const response = await fetch(`${API_BASE_URL}/api/v1/expressions`, { headers: authHeaders() });
             if (!response.ok) {
                 throw new Error(`Ошибка: ${response.status}`);
             }
@@ -58,7 +112,7 @@ document.addEventListener("DOMContentLoaded", () => {
         }
 
         try {
-            const response = await fetch(`${API_BASE_URL}/api/v1/expressions/${expressionId}`);
+            const response = await fetch(`${API_BASE_URL}/api/v1/expressions/${expressionId}`, { headers: authHeaders() });
             if (!response.ok) {
                 throw new Error(`Ошибка: ${response.status}`);
             }